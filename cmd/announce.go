@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ayu-ch/bittorrent-client/session"
+	"github.com/ayu-ch/bittorrent-client/torrent"
+)
+
+// runAnnounce loads one or more torrents and announces them to their trackers.
+// Directories are searched for .torrent files.
+//
+// Usage:
+//
+//	[-port N] [-tracker URL]... [-tracker-list URL] [-announce-param key=value]...
+//	[-label L]... [-all-trackers] [-doh URL] [-state-dir DIR] [-tracker-health FILE] [-from-file list.txt] [-json|-quiet]
+//	<file.torrent|dir>...
+func runAnnounce(args []string) {
+	fs := flag.NewFlagSet("announce", flag.ExitOnError)
+	port := fs.Uint("port", 6881, "port to report in announces")
+	var extraTrackers stringList
+	fs.Var(&extraTrackers, "tracker", "extra tracker to add to non-private torrents (repeatable)")
+	trackerList := fs.String("tracker-list", "", "URL of a public tracker list to add to non-private torrents")
+	fromFile := fs.String("from-file", "", "file listing torrent paths, one per line")
+	var announceParams stringList
+	fs.Var(&announceParams, "announce-param", "extra key=value query parameter sent with announces (repeatable)")
+	var labels stringList
+	fs.Var(&labels, "label", "label to record the torrents under in the search index (repeatable)")
+	allTrackers := fs.Bool("all-trackers", false, "announce to every tracker at once and merge the peers")
+	doh := fs.String("doh", "", "DNS-over-HTTPS server URL used to resolve trackers")
+	stateDir := fs.String("state-dir", "", "directory for the client's state (default: the OS state directory)")
+	healthFile := fs.String("tracker-health", "", "file to keep tracker announce history in (default: in the state directory)")
+	out := addOutputFlags(fs)
+	fs.Parse(args)
+	if err := checkPort(*port); err != nil {
+		fatalf(exitUsage, "%v", err)
+	}
+
+	addOpts := &session.AddTorrentOptions{AnnounceParams: url.Values{}, Labels: labels}
+	for _, param := range announceParams {
+		key, value, ok := strings.Cut(param, "=")
+		if !ok || key == "" {
+			fatalf(exitUsage, "invalid announce parameter %q, expected key=value", param)
+		}
+		addOpts.AnnounceParams.Add(key, value)
+	}
+
+	paths := fs.Args()
+	if *fromFile != "" {
+		listed, err := readPathList(*fromFile)
+		if err != nil {
+			fatalf(exitFailure, "failed to read %s: %v", *fromFile, err)
+		}
+		paths = append(paths, listed...)
+	}
+	torrentFiles, err := expandTorrentPaths(paths)
+	if err != nil {
+		fatalf(exitTorrent, "failed to list torrents: %v", err)
+	}
+	if len(torrentFiles) == 0 {
+		fatalf(exitUsage, "torrent filename not provided as a command-line argument")
+		return
+	}
+
+	opts := []session.Option{
+		session.WithListenPort(uint16(*port)),
+		session.WithLogger(out.logger()),
+		session.WithExtraTrackers(extraTrackers...),
+		session.WithAnnounceToAllTrackers(*allTrackers),
+	}
+	if *trackerList != "" {
+		opts = append(opts, session.WithTrackerList(*trackerList, 0))
+	}
+	if *stateDir == "" {
+		dir, err := session.DefaultStateDir()
+		if err != nil {
+			fatalf(exitFailure, "failed to find a state directory, use -state-dir: %v", err)
+		}
+		*stateDir = dir
+	}
+	opts = append(opts, session.WithStateDir(*stateDir))
+	if *healthFile != "" {
+		opts = append(opts, session.WithTrackerHealthFile(*healthFile))
+	}
+	if *doh != "" {
+		opts = append(opts, session.WithDNSOverHTTPS(*doh))
+	}
+
+	sess, err := session.NewSession(opts...)
+	if err != nil {
+		fatalf(exitFailure, "failed to create session: %v", err)
+		return
+	}
+	defer sess.Close()
+
+	if len(torrentFiles) == 1 {
+		announceOne(sess, torrentFiles[0], addOpts, out)
+		return
+	}
+	announceMany(sess, torrentFiles, addOpts, out)
+}
+
+// announceResult is the JSON form of the announce output, for one torrent or many.
+type announceResult struct {
+	Torrents  []announcedTorrent `json:"torrents"`
+	Announced int                `json:"announced"`
+	Total     int                `json:"total"`
+}
+
+// announcedTorrent is the outcome of announcing one torrent. Name and
+// InfoHash are empty if the torrent file couldn't be loaded.
+type announcedTorrent struct {
+	Path       string   `json:"path"`
+	Name       string   `json:"name,omitempty"`
+	InfoHash   string   `json:"info_hash,omitempty"`
+	Interval   int      `json:"interval,omitempty"`
+	Seeders    int      `json:"seeders"`
+	Leechers   int      `json:"leechers"`
+	ExternalIP string   `json:"external_ip,omitempty"`
+	Peers      []string `json:"peers"`
+	Error      string   `json:"error,omitempty"`
+}
+
+// newAnnouncedTorrent records the outcome of announcing t, loaded from path.
+func newAnnouncedTorrent(path string, t *torrent.Torrent, resp *torrent.TrackerResponse, err error) announcedTorrent {
+	a := announcedTorrent{Path: path, Peers: []string{}}
+	if t != nil {
+		a.Name = t.Info.Name
+		a.InfoHash = fmt.Sprintf("%x", t.InfoHash)
+	}
+	if err != nil {
+		a.Error = err.Error()
+		return a
+	}
+	a.Interval = resp.Interval
+	a.Seeders, a.Leechers = resp.Complete, resp.Incomplete
+	if resp.ExternalIP != nil {
+		a.ExternalIP = resp.ExternalIP.String()
+	}
+	for _, peer := range resp.Peers {
+		a.Peers = append(a.Peers, peer.String())
+	}
+	return a
+}
+
+// announceOne announces a single torrent and prints the peers it got back.
+func announceOne(sess *session.Session, torrentFile string, addOpts *session.AddTorrentOptions, out *output) {
+	// Initialize Torrent from the .torrent file
+	torrentObj, err := torrent.NewTorrent(torrentFile)
+	if err != nil {
+		fatalf(exitTorrent, "failed to create Torrent object: %v", err)
+		return
+	}
+
+	// fmt.Printf("The unmarshalled torrent file is: \n %+v \n", torrentObj)
+
+	torrentObj, err = sess.AddTorrent(torrentObj, addOpts)
+	if err != nil {
+		fatalf(exitFailure, "failed to add torrent: %v", err)
+		return
+	}
+
+	// Announce to the tracker
+	resp, err := sess.Announce(context.Background(), torrentObj)
+	if err != nil {
+		if out.json {
+			out.emit(announceResult{Torrents: []announcedTorrent{newAnnouncedTorrent(torrentFile, torrentObj, nil, err)}, Total: 1})
+			os.Exit(exitNetwork)
+		}
+		fatalf(exitNetwork, "failed to announce to tracker: %v", err)
+		return
+	}
+
+	out.emit(announceResult{Torrents: []announcedTorrent{newAnnouncedTorrent(torrentFile, torrentObj, resp, nil)}, Announced: 1, Total: 1})
+	out.printf("Tracker interval: %d seconds\n", resp.Interval)
+	out.printf("Swarm: %d seeders, %d leechers\n", resp.Complete, resp.Incomplete)
+	if resp.ExternalIP != nil {
+		out.printf("External IP: %s\n", resp.ExternalIP)
+	}
+	for _, peer := range resp.Peers {
+		out.printf("Peer: %s\n", peer)
+	}
+}
+
+// announceMany adds every torrent to the session, announces them all and reports aggregate progress.
+func announceMany(sess *session.Session, torrentFiles []string, addOpts *session.AddTorrentOptions, out *output) {
+	result := announceResult{Torrents: []announcedTorrent{}}
+	paths := make(map[*torrent.Torrent]string)
+	skipped, failed := 0, 0
+	for _, path := range torrentFiles {
+		t, err := torrent.NewTorrent(path)
+		if err == nil {
+			t, err = sess.AddTorrent(t, addOpts)
+		}
+		if err != nil {
+			skipped++
+			result.Torrents = append(result.Torrents, newAnnouncedTorrent(path, nil, nil, err))
+			if !out.quiet {
+				warnf("skipping %s: %v", path, err)
+			}
+			continue
+		}
+		if _, ok := paths[t]; !ok {
+			paths[t] = path
+		}
+	}
+
+	total := len(sess.Torrents())
+	done, peers := 0, 0
+	for r := range sess.AnnounceAll(context.Background()) {
+		done++
+		result.Torrents = append(result.Torrents, newAnnouncedTorrent(paths[r.Torrent], r.Torrent, r.Response, r.Err))
+		if r.Err != nil {
+			failed++
+			out.printf("[%d/%d] %s: %s\n", done, total, r.Torrent.Info.Name, colored(colorRed, r.Err.Error()))
+			continue
+		}
+		result.Announced++
+		peers += len(r.Response.Peers)
+		out.printf("[%d/%d] %s: %d peers, %d seeders, %d leechers\n", done, total, r.Torrent.Info.Name,
+			len(r.Response.Peers), r.Response.Complete, r.Response.Incomplete)
+	}
+	result.Total = len(result.Torrents)
+
+	out.emit(result)
+	out.printf("Announced %d of %d torrents, %d peers in total\n", result.Announced, total, peers)
+	switch {
+	case skipped > 0:
+		os.Exit(exitTorrent)
+	case failed > 0:
+		os.Exit(exitNetwork)
+	}
+}
+
+// readPathList reads one path per line, skipping blank lines and # comments.
+func readPathList(name string) ([]string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var paths []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		paths = append(paths, line)
+	}
+	return paths, scanner.Err()
+}
+
+// expandTorrentPaths replaces each directory in paths with the .torrent files it contains.
+func expandTorrentPaths(paths []string) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		matches, err := filepath.Glob(filepath.Join(path, "*.torrent"))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+	return files, nil
+}
@@ -0,0 +1,394 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ayu-ch/bittorrent-client/pkg/peerwire"
+	"github.com/ayu-ch/bittorrent-client/session"
+	"github.com/ayu-ch/bittorrent-client/torrent"
+)
+
+// Outcomes of a conformance check.
+const (
+	checkPass = "pass"
+	checkFail = "fail"
+	checkSkip = "skip"
+)
+
+// statusColors maps check outcomes to their terminal colors.
+var statusColors = map[string]string{
+	checkPass: colorGreen,
+	checkFail: colorRed,
+	checkSkip: colorYellow,
+}
+
+// conformanceCheck is one behavior the target peer is tested for. Every
+// check runs on its own connection.
+type conformanceCheck struct {
+	name string
+	run  func(ct *conformanceTarget) (status, detail string)
+}
+
+// conformanceChecks lists the checks in the order they run.
+var conformanceChecks = []conformanceCheck{
+	{"handshake", checkHandshake},
+	{"handshake sent in fragments", checkSlowHandshake},
+	{"unknown info hash is dropped", checkUnknownInfoHash},
+	{"bad protocol string is dropped", checkBadProtocol},
+	{"keep-alive is ignored", checkKeepAlive},
+	{"unknown message is ignored", checkUnknownMessage},
+	{"oversized message is dropped", checkOversizedMessage},
+	{"malformed have is dropped", checkMalformedHave},
+	{"fast: first message is a piece summary", checkFastFirstMessage},
+	{"fast: request while choked is rejected", checkFastRejectWhileChoked},
+}
+
+// conformanceTarget is the peer under test.
+type conformanceTarget struct {
+	addr    string
+	t       *torrent.Torrent
+	sess    *session.Session
+	peerID  [20]byte
+	timeout time.Duration
+}
+
+// conformanceResult is a row of the compliance matrix, also its JSON form.
+type conformanceResult struct {
+	Check  string `json:"check"`
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// runConformance exercises a peer implementation with handshake variants,
+// malformed messages and fast extension behaviors, and prints which checks
+// it passes. It exits with status 1 if any check fails.
+//
+// Usage:
+//
+//	conformance -peer host:port [-timeout D] [-json|-quiet] <file.torrent>
+func runConformance(args []string) {
+	fs := flag.NewFlagSet("conformance", flag.ExitOnError)
+	peerAddr := fs.String("peer", "", "address of the peer to test, which must have the torrent")
+	timeout := fs.Duration("timeout", 5*time.Second, "how long to wait for each expected reaction")
+	out := addOutputFlags(fs)
+	fs.Parse(args)
+
+	if *peerAddr == "" || fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: conformance -peer host:port [-timeout D] [-json|-quiet] <file.torrent>")
+		os.Exit(exitUsage)
+	}
+
+	t, err := torrent.NewTorrent(fs.Arg(0))
+	if err != nil {
+		fatalf(exitTorrent, "failed to create Torrent object: %v", err)
+	}
+	sess, err := session.NewSession()
+	if err != nil {
+		fatalf(exitFailure, "failed to create session: %v", err)
+	}
+	ct := &conformanceTarget{addr: *peerAddr, t: t, sess: sess, peerID: sess.PeerID(), timeout: *timeout}
+
+	results := []conformanceResult{}
+	failed := 0
+	for _, check := range conformanceChecks {
+		status, detail := check.run(ct)
+		if status == checkFail {
+			failed++
+		}
+		results = append(results, conformanceResult{Check: check.name, Status: status, Detail: detail})
+		line := fmt.Sprintf("%-42s  %s", check.name, detail)
+		out.printf("%s  %s\n", colored(statusColors[status], fmt.Sprintf("%-4s", status)), strings.TrimRight(line, " "))
+	}
+	out.emit(results)
+	if failed > 0 {
+		os.Exit(exitFailure)
+	}
+}
+
+// dial connects to the target with the connection deadline set.
+func (ct *conformanceTarget) dial() (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), ct.timeout)
+	defer cancel()
+	conn, err := ct.sess.DialPeer(ctx, ct.addr)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(ct.timeout))
+	return conn, nil
+}
+
+// handshake returns our handshake for the target's torrent, advertising the fast extension.
+func (ct *conformanceTarget) handshake() peerwire.Handshake {
+	h := peerwire.Handshake{InfoHash: ct.t.InfoHash, PeerID: ct.peerID}
+	h.Set(peerwire.FastBit)
+	return h
+}
+
+// connect dials the target and exchanges handshakes.
+func (ct *conformanceTarget) connect() (net.Conn, peerwire.Handshake, error) {
+	conn, err := ct.dial()
+	if err != nil {
+		return nil, peerwire.Handshake{}, err
+	}
+	if err := peerwire.WriteHandshake(conn, ct.handshake()); err != nil {
+		conn.Close()
+		return nil, peerwire.Handshake{}, err
+	}
+	remote, err := peerwire.ReadHandshake(conn)
+	if err != nil {
+		conn.Close()
+		return nil, peerwire.Handshake{}, fmt.Errorf("no handshake: %w", err)
+	}
+	return conn, remote, nil
+}
+
+// closedByPeer reports whether the peer closes conn within the timeout,
+// discarding anything it sends first.
+func closedByPeer(conn net.Conn) bool {
+	_, err := io.Copy(io.Discard, conn)
+	var netErr net.Error
+	return !(errors.As(err, &netErr) && netErr.Timeout())
+}
+
+// stillOpen sends an Interested message after a test message and reports
+// whether the connection survives until the timeout.
+func stillOpen(conn net.Conn) (bool, error) {
+	if err := peerwire.WriteMessage(conn, peerwire.Interested{}); err != nil {
+		return false, err
+	}
+	return !closedByPeer(conn), nil
+}
+
+// checkHandshake expects the peer to answer a regular handshake for its torrent.
+func checkHandshake(ct *conformanceTarget) (string, string) {
+	conn, remote, err := ct.connect()
+	if err != nil {
+		return checkFail, err.Error()
+	}
+	defer conn.Close()
+	if remote.InfoHash != ct.t.InfoHash {
+		return checkFail, fmt.Sprintf("answered with info hash %x", remote.InfoHash)
+	}
+	return checkPass, fmt.Sprintf("peer ID %q", bytes.TrimRight(remote.PeerID[:8], "\x00"))
+}
+
+// checkSlowHandshake expects a handshake arriving in small, delayed fragments to be answered.
+func checkSlowHandshake(ct *conformanceTarget) (string, string) {
+	conn, err := ct.dial()
+	if err != nil {
+		return checkFail, err.Error()
+	}
+	defer conn.Close()
+
+	var buf bytes.Buffer
+	peerwire.WriteHandshake(&buf, ct.handshake())
+	// Send the handshake in pieces, pausing in between, as a slow link would.
+	for data := buf.Bytes(); len(data) > 0; {
+		n := min(len(data), 7)
+		if _, err := conn.Write(data[:n]); err != nil {
+			return checkFail, err.Error()
+		}
+		data = data[n:]
+		time.Sleep(ct.timeout / 20)
+	}
+	conn.SetDeadline(time.Now().Add(ct.timeout))
+	if _, err := peerwire.ReadHandshake(conn); err != nil {
+		return checkFail, fmt.Sprintf("no handshake: %v", err)
+	}
+	return checkPass, ""
+}
+
+// checkUnknownInfoHash expects the peer to drop a handshake for a torrent it doesn't have.
+func checkUnknownInfoHash(ct *conformanceTarget) (string, string) {
+	conn, err := ct.dial()
+	if err != nil {
+		return checkFail, err.Error()
+	}
+	defer conn.Close()
+
+	h := ct.handshake()
+	for i := range h.InfoHash {
+		h.InfoHash[i] = ^h.InfoHash[i]
+	}
+	if err := peerwire.WriteHandshake(conn, h); err != nil {
+		return checkFail, err.Error()
+	}
+	if remote, err := peerwire.ReadHandshake(conn); err == nil && remote.InfoHash == h.InfoHash {
+		return checkFail, "peer accepted a torrent it can't have"
+	}
+	if !closedByPeer(conn) {
+		return checkFail, "connection left open"
+	}
+	return checkPass, ""
+}
+
+// checkBadProtocol expects the peer to drop a handshake with the wrong protocol string.
+func checkBadProtocol(ct *conformanceTarget) (string, string) {
+	conn, err := ct.dial()
+	if err != nil {
+		return checkFail, err.Error()
+	}
+	defer conn.Close()
+
+	var buf bytes.Buffer
+	peerwire.WriteHandshake(&buf, ct.handshake())
+	data := buf.Bytes()
+	copy(data[1:], "BitTorrent protocox")
+	if _, err := conn.Write(data); err != nil {
+		return checkFail, err.Error()
+	}
+	if !closedByPeer(conn) {
+		return checkFail, "connection left open"
+	}
+	return checkPass, ""
+}
+
+// checkKeepAlive expects a keep-alive to leave the connection open.
+func checkKeepAlive(ct *conformanceTarget) (string, string) {
+	conn, _, err := ct.connect()
+	if err != nil {
+		return checkFail, err.Error()
+	}
+	defer conn.Close()
+	if err := peerwire.WriteKeepAlive(conn); err != nil {
+		return checkFail, err.Error()
+	}
+	open, err := stillOpen(conn)
+	if err != nil || !open {
+		return checkFail, "connection closed after a keep-alive"
+	}
+	return checkPass, ""
+}
+
+// checkUnknownMessage expects a message with an unassigned ID to be ignored.
+func checkUnknownMessage(ct *conformanceTarget) (string, string) {
+	conn, _, err := ct.connect()
+	if err != nil {
+		return checkFail, err.Error()
+	}
+	defer conn.Close()
+	if err := peerwire.WriteMessage(conn, peerwire.Unknown{MessageID: 99, Payload: []byte("x")}); err != nil {
+		return checkFail, err.Error()
+	}
+	open, err := stillOpen(conn)
+	if err != nil || !open {
+		return checkFail, "connection closed after message ID 99"
+	}
+	return checkPass, ""
+}
+
+// checkOversizedMessage expects the peer to drop a connection announcing a huge message.
+func checkOversizedMessage(ct *conformanceTarget) (string, string) {
+	conn, _, err := ct.connect()
+	if err != nil {
+		return checkFail, err.Error()
+	}
+	defer conn.Close()
+	// Announce a message of almost 4GiB and never send it.
+	if _, err := conn.Write([]byte{0xff, 0xff, 0xff, 0xf0, byte(peerwire.MsgPiece)}); err != nil {
+		return checkFail, err.Error()
+	}
+	if !closedByPeer(conn) {
+		return checkFail, "connection left open"
+	}
+	return checkPass, ""
+}
+
+// checkMalformedHave expects the peer to drop a connection sending a have with a short payload.
+func checkMalformedHave(ct *conformanceTarget) (string, string) {
+	conn, _, err := ct.connect()
+	if err != nil {
+		return checkFail, err.Error()
+	}
+	defer conn.Close()
+	// A have message carrying two bytes instead of a four byte index.
+	if _, err := conn.Write([]byte{0, 0, 0, 3, byte(peerwire.MsgHave), 0, 1}); err != nil {
+		return checkFail, err.Error()
+	}
+	if !closedByPeer(conn) {
+		return checkFail, "connection left open"
+	}
+	return checkPass, ""
+}
+
+// checkFastFirstMessage expects a fast extension peer to start with a bitfield, have all or have none.
+func checkFastFirstMessage(ct *conformanceTarget) (string, string) {
+	conn, remote, err := ct.connect()
+	if err != nil {
+		return checkFail, err.Error()
+	}
+	defer conn.Close()
+	if !remote.Has(peerwire.FastBit) {
+		return checkSkip, "peer doesn't support the fast extension"
+	}
+
+	msg, err := nextMessage(conn)
+	if err != nil {
+		return checkFail, fmt.Sprintf("no message: %v", err)
+	}
+	switch msg.(type) {
+	case peerwire.Bitfield, peerwire.HaveAll, peerwire.HaveNone:
+		return checkPass, msg.ID().String()
+	}
+	return checkFail, fmt.Sprintf("first message is %s", msg.ID())
+}
+
+// checkFastRejectWhileChoked expects a fast extension peer to reject requests while choking us.
+func checkFastRejectWhileChoked(ct *conformanceTarget) (string, string) {
+	conn, remote, err := ct.connect()
+	if err != nil {
+		return checkFail, err.Error()
+	}
+	defer conn.Close()
+	if !remote.Has(peerwire.FastBit) {
+		return checkSkip, "peer doesn't support the fast extension"
+	}
+
+	// Requesting without having sent Interested means we stay choked, unless
+	// the piece is allowed fast, in which case the peer may serve it.
+	req := peerwire.Request{Index: 0, Begin: 0, Length: uint32(min(blockSize, ct.t.Info.PieceSize(0)))}
+	if err := peerwire.WriteMessage(conn, req); err != nil {
+		return checkFail, err.Error()
+	}
+	allowedFast := false
+	for {
+		msg, err := nextMessage(conn)
+		if err != nil {
+			return checkFail, fmt.Sprintf("no reject: %v", err)
+		}
+		switch m := msg.(type) {
+		case peerwire.AllowedFast:
+			allowedFast = allowedFast || m.Index == req.Index
+		case peerwire.Reject:
+			if m.Index == req.Index && m.Begin == req.Begin && m.Length == req.Length {
+				return checkPass, ""
+			}
+		case peerwire.Unchoke:
+			return checkSkip, "peer unchoked us without interest"
+		case peerwire.Piece:
+			if allowedFast {
+				return checkPass, "served an allowed fast piece"
+			}
+			return checkFail, "served a piece while choking us"
+		}
+	}
+}
+
+// nextMessage reads the next message, skipping keep-alives.
+func nextMessage(conn net.Conn) (peerwire.Message, error) {
+	for {
+		msg, err := peerwire.ReadMessage(conn)
+		if err != nil || msg != nil {
+			return msg, err
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ayu-ch/bittorrent-client/torrent"
+)
+
+// inspectResult is the JSON form of inspect's output.
+type inspectResult struct {
+	Name        string        `json:"name"`
+	InfoHash    string        `json:"info_hash"`
+	Size        int64         `json:"size"`
+	PieceLength int64         `json:"piece_length"`
+	Pieces      int           `json:"pieces"`
+	Private     bool          `json:"private"`
+	Trackers    []string      `json:"trackers"`
+	Files       []inspectFile `json:"files"`
+}
+
+// inspectFile is a file in inspectResult. FirstPiece and LastPiece are -1 for empty files.
+type inspectFile struct {
+	Path       string `json:"path"`
+	Size       int64  `json:"size"`
+	FirstPiece int    `json:"first_piece"`
+	LastPiece  int    `json:"last_piece"`
+}
+
+// runInspect prints the metadata and file list of a torrent without starting it.
+//
+// Usage:
+//
+//	inspect [-json|-quiet] <file.torrent>
+func runInspect(args []string) {
+	fs := flag.NewFlagSet("inspect", flag.ExitOnError)
+	out := addOutputFlags(fs)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: inspect [-json|-quiet] <file.torrent>")
+		os.Exit(exitUsage)
+	}
+
+	t, err := torrent.NewTorrent(fs.Arg(0))
+	if err != nil {
+		fatalf(exitTorrent, "failed to create Torrent object: %v", err)
+	}
+
+	result := inspectResult{
+		Name:        t.Info.Name,
+		InfoHash:    fmt.Sprintf("%x", t.InfoHash),
+		Size:        t.Info.TotalLength(),
+		PieceLength: t.Info.PieceLength,
+		Pieces:      len(t.Info.Pieces),
+		Private:     t.Info.Private,
+		Trackers:    t.Trackers(),
+		Files:       []inspectFile{},
+	}
+	for _, f := range t.Info.FileExtents() {
+		first, end := t.Info.PieceRange(f.Offset, f.Length)
+		file := inspectFile{Path: strings.Join(f.Path, "/"), Size: f.Length, FirstPiece: -1, LastPiece: -1}
+		if end > first {
+			file.FirstPiece, file.LastPiece = first, end-1
+		}
+		result.Files = append(result.Files, file)
+	}
+	if out.json {
+		out.emit(result)
+		return
+	}
+
+	out.printf("Name:         %s\n", result.Name)
+	out.printf("Info hash:    %s\n", result.InfoHash)
+	out.printf("Size:         %s (%d bytes)\n", formatBytes(result.Size), result.Size)
+	out.printf("Pieces:       %d x %s\n", result.Pieces, formatBytes(result.PieceLength))
+	out.printf("Private:      %t\n", result.Private)
+	for i, tracker := range result.Trackers {
+		label := ""
+		if i == 0 {
+			label = "Trackers:"
+		}
+		out.printf("%-14s%s\n", label, tracker)
+	}
+
+	out.printf("\n%5s  %10s  %-15s  %s\n", "Index", "Size", "Pieces", "Path")
+	for i, f := range result.Files {
+		pieces := "-"
+		if f.FirstPiece >= 0 {
+			pieces = fmt.Sprintf("%d-%d", f.FirstPiece, f.LastPiece)
+		}
+		out.printf("%5d  %10s  %-15s  %s\n", i, formatBytes(f.Size), pieces, f.Path)
+	}
+}
+
+// formatBytes renders a byte count using binary units.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
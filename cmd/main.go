@@ -1,53 +1,54 @@
 package main
 
 import (
-	"crypto/rand"
-	"log"
 	"os"
-
+	"strings"
 	// "github.com/ayu-ch/bittorrent-client/pkg/bencode"
-	"github.com/ayu-ch/bittorrent-client/torrent"
 )
 
-func generatePeerID() ([20]byte, error) {
-	var peerID [20]byte
-	_, err := rand.Read(peerID[:])
-	if err != nil {
-		return [20]byte{}, err
-	}
-	return peerID, nil
+// stringList is a flag that can be given several times.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
 }
 
 func main() {
 	if len(os.Args) < 2 {
-		log.Fatal("Torrent filename not provided as a command-line argument.")
-		return
+		fatalf(exitUsage, "torrent filename not provided as a command-line argument")
 	}
 
-	torrentFile := os.Args[1]
-
-	// Initialize Torrent from the .torrent file
-	torrentObj, err := torrent.NewTorrent(torrentFile)
-	if err != nil {
-		log.Fatalf("Failed to create Torrent object: %v", err)
+	switch os.Args[1] {
+	case "tracker-test":
+		runTrackerTest(os.Args[2:])
 		return
-	}
-
-	// fmt.Printf("The unmarshalled torrent file is: \n %+v \n", torrentObj)
-
-	// Generate a random peer ID
-	peerID, err := generatePeerID()
-	if err != nil {
-		log.Fatalf("Failed to generate peer ID: %v", err)
+	case "diff":
+		runDiff(os.Args[2:])
 		return
-	}
-
-	// Example port
-	port := uint16(6881)
-
-	// Announce to the tracker
-	if err := torrentObj.AnnounceToTracker(peerID, port); err != nil {
-		log.Fatalf("Failed to announce to tracker: %v", err)
+	case "inspect":
+		runInspect(os.Args[2:])
+		return
+	case "speedtest":
+		runSpeedTest(os.Args[2:])
+		return
+	case "verify":
+		runVerify(os.Args[2:])
+		return
+	case "conformance":
+		runConformance(os.Args[2:])
+		return
+	case "search":
+		runSearch(os.Args[2:])
+		return
+	case "soak":
+		runSoak(os.Args[2:])
 		return
 	}
+
+	runAnnounce(os.Args[1:])
 }
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+)
+
+// Exit codes shared by all commands. Flag parsing errors also exit with exitUsage.
+const (
+	// exitFailure means the command ran but what it checked failed, such as
+	// torrents differing or pieces missing.
+	exitFailure = 1
+	exitUsage   = 2
+	// exitTorrent means a torrent file couldn't be read or is invalid.
+	exitTorrent = 3
+	// exitNetwork means trackers or peers couldn't be reached or answered with errors.
+	exitNetwork = 4
+)
+
+// ANSI colors used for terminal output.
+const (
+	colorRed    = "\x1b[31m"
+	colorGreen  = "\x1b[32m"
+	colorYellow = "\x1b[33m"
+	colorReset  = "\x1b[0m"
+)
+
+// noColor disables colors, set by -no-color.
+var noColor bool
+
+// output controls how a command reports its results: human-readable text by
+// default, colored when printing to a terminal, a single JSON document on
+// stdout with -json, or nothing but errors with -quiet. Exit codes are the
+// same in every mode.
+type output struct {
+	json  bool
+	quiet bool
+}
+
+// addOutputFlags registers the -json, -quiet and -no-color flags on fs.
+func addOutputFlags(fs *flag.FlagSet) *output {
+	o := &output{}
+	fs.BoolVar(&o.json, "json", false, "print results as JSON")
+	fs.BoolVar(&o.quiet, "quiet", false, "print nothing but errors")
+	fs.BoolVar(&noColor, "no-color", false, "don't color output, even on a terminal")
+	return o
+}
+
+// printf prints human-readable output, which is suppressed with -json and -quiet.
+func (o *output) printf(format string, args ...any) {
+	if !o.json && !o.quiet {
+		fmt.Printf(format, args...)
+	}
+}
+
+// emit writes v as JSON to stdout when -json is set.
+func (o *output) emit(v any) {
+	if !o.json {
+		return
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		fatalf(exitFailure, "failed to write JSON: %v", err)
+	}
+}
+
+// logger returns the logger for progress messages, which -quiet silences.
+func (o *output) logger() *log.Logger {
+	if o.quiet {
+		return log.New(io.Discard, "", 0)
+	}
+	return log.Default()
+}
+
+// colored wraps s in color if stdout is a terminal that accepts colors.
+func colored(color, s string) string {
+	return colorize(os.Stdout, color, s)
+}
+
+// colorize wraps s in color if f is a terminal and colors aren't disabled
+// with -no-color or the NO_COLOR environment variable.
+func colorize(f *os.File, color, s string) string {
+	if noColor || os.Getenv("NO_COLOR") != "" {
+		return s
+	}
+	if fi, err := f.Stat(); err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+		return s
+	}
+	return color + s + colorReset
+}
+
+// warnf reports a problem the command carries on after, on stderr.
+func warnf(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, "%s %s\n", colorize(os.Stderr, colorYellow, "warning:"), fmt.Sprintf(format, args...))
+}
+
+// fatalf reports an error on stderr and exits with code.
+func fatalf(code int, format string, args ...any) {
+	fmt.Fprintf(os.Stderr, "%s %s\n", colorize(os.Stderr, colorRed, "error:"), fmt.Sprintf(format, args...))
+	os.Exit(code)
+}
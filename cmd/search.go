@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ayu-ch/bittorrent-client/session"
+)
+
+// runSearch looks up torrents in the index of every torrent added with the
+// state directory, by name, label, info hash or file path, and exits with
+// status 1 if none match.
+//
+// Usage:
+//
+//	search [-state-dir DIR] [-json|-quiet] <query>
+func runSearch(args []string) {
+	fs := flag.NewFlagSet("search", flag.ExitOnError)
+	stateDir := fs.String("state-dir", "", "directory for the client's state (default: the OS state directory)")
+	out := addOutputFlags(fs)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: search [-state-dir DIR] [-json|-quiet] <query>")
+		os.Exit(exitUsage)
+	}
+
+	if *stateDir == "" {
+		dir, err := session.DefaultStateDir()
+		if err != nil {
+			fatalf(exitFailure, "failed to find a state directory, use -state-dir: %v", err)
+		}
+		*stateDir = dir
+	}
+	sess, err := session.NewSession(session.WithReadOnlyStateDir(*stateDir), session.WithLogger(out.logger()))
+	if err != nil {
+		fatalf(exitFailure, "failed to create session: %v", err)
+	}
+
+	results := sess.Search(fs.Arg(0))
+	if results == nil {
+		results = []session.SearchResult{}
+	}
+	out.emit(results)
+	for _, r := range results {
+		out.printf("%s %s (%s)", r.Name, r.InfoHash, formatBytes(r.Size))
+		if len(r.Labels) > 0 {
+			out.printf(" [%s]", strings.Join(r.Labels, ", "))
+		}
+		out.printf("\n")
+		for _, f := range r.MatchedFiles {
+			out.printf("  %s (%s)\n", f.Path, formatBytes(f.Size))
+		}
+	}
+	if len(results) == 0 {
+		os.Exit(exitFailure)
+	}
+}
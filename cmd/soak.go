@@ -0,0 +1,430 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/ayu-ch/bittorrent-client/pkg/bencode"
+	"github.com/ayu-ch/bittorrent-client/pkg/peerwire"
+	"github.com/ayu-ch/bittorrent-client/session"
+	"github.com/ayu-ch/bittorrent-client/torrent"
+)
+
+// soakPeers is the number of peers the in-process tracker returns per announce.
+const soakPeers = 50
+
+const (
+	// soakPieceLength is the piece length of the synthetic torrents.
+	soakPieceLength = 32 * 1024
+	// soakPieces is the number of pieces of each synthetic torrent.
+	soakPieces = 2
+)
+
+// soakResult is the JSON form of soak's output.
+type soakResult struct {
+	Torrents  int    `json:"torrents"`
+	Duration  string `json:"duration"`
+	Announces int    `json:"announces"`
+	Failures  int    `json:"failures"`
+	Downloads int    `json:"downloads"`
+	// DownloadFailures counts downloads from the swarm that failed or
+	// didn't verify.
+	DownloadFailures int          `json:"download_failures"`
+	Samples          []soakSample `json:"samples"`
+	Violations       []string     `json:"violations"`
+	Passed           bool         `json:"passed"`
+}
+
+// soakSample is the resource usage of the process at one point of the run.
+// FDs is -1 where open file descriptors can't be counted.
+type soakSample struct {
+	Elapsed    string `json:"elapsed"`
+	Announces  int    `json:"announces"`
+	Heap       uint64 `json:"heap"`
+	Goroutines int    `json:"goroutines"`
+	FDs        int    `json:"fds"`
+}
+
+// runSoak announces synthetic torrents to an in-process tracker over and
+// over for a long time, and after each round downloads every torrent from an
+// in-process swarm of seeds over the peer wire protocol. It samples memory,
+// goroutines and open file descriptors, and exits with status 1 if any of
+// them grows past its threshold, to catch leaks before a release. Growth is
+// measured against the first sample, taken after the first round.
+//
+// The tracker hands out made-up addresses, since loopback peers are dropped
+// from tracker responses; the swarm's seeds are dialed directly.
+//
+// Usage:
+//
+//	soak [-torrents N] [-peers N] [-duration D] [-interval D] [-sample D]
+//	[-max-heap-growth MB] [-max-goroutines N] [-max-fds N] [-json|-quiet]
+func runSoak(args []string) {
+	fs := flag.NewFlagSet("soak", flag.ExitOnError)
+	torrents := fs.Int("torrents", 100, "number of synthetic torrents to announce")
+	peers := fs.Int("peers", 4, "number of in-process seeds to download from, 0 to only announce")
+	duration := fs.Duration("duration", time.Hour, "how long to run")
+	interval := fs.Duration("interval", 10*time.Second, "time over which each round of announces is spread")
+	sample := fs.Duration("sample", time.Minute, "how often to sample resource usage")
+	maxHeapGrowth := fs.Int("max-heap-growth", 64, "fail if the live heap grows by more than this many MiB")
+	maxGoroutines := fs.Int("max-goroutines", 100, "fail if the goroutine count grows by more than this")
+	maxFDs := fs.Int("max-fds", 100, "fail if the number of open file descriptors grows by more than this")
+	out := addOutputFlags(fs)
+	fs.Parse(args)
+	if fs.NArg() != 0 || *torrents <= 0 || *peers < 0 {
+		fmt.Fprintln(os.Stderr, "Usage: soak [-torrents N] [-peers N] [-duration D] [-interval D] [-sample D] [-max-heap-growth MB] [-max-goroutines N] [-max-fds N] [-json|-quiet]")
+		os.Exit(exitUsage)
+	}
+
+	announceURL, stop, err := startSoakTracker()
+	if err != nil {
+		fatalf(exitNetwork, "failed to start tracker: %v", err)
+	}
+	defer stop()
+	swarm, err := startSoakSwarm(*peers)
+	if err != nil {
+		fatalf(exitNetwork, "failed to start swarm: %v", err)
+	}
+	defer swarm.close()
+
+	sess, err := session.NewSession(
+		session.WithAnnounceSpread(*interval),
+		session.WithDualStackAnnounce(false),
+		session.WithDNSTrackerPreferences(false),
+	)
+	if err != nil {
+		fatalf(exitFailure, "failed to create session: %v", err)
+	}
+	var soakTorrents []*torrent.Torrent
+	for i := 0; i < *torrents; i++ {
+		t, content, err := soakTorrent(i, announceURL)
+		if err == nil {
+			t, err = sess.AddTorrent(t, nil)
+		}
+		if err != nil {
+			fatalf(exitFailure, "failed to create torrent %d: %v", i, err)
+		}
+		swarm.add(t.InfoHash, content)
+		soakTorrents = append(soakTorrents, t)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *duration)
+	defer cancel()
+	start := time.Now()
+	result := soakResult{Torrents: *torrents, Samples: []soakSample{}, Violations: []string{}}
+	var lastSample time.Time
+	for ctx.Err() == nil {
+		for r := range sess.AnnounceAll(ctx) {
+			if errors.Is(r.Err, context.DeadlineExceeded) {
+				continue
+			}
+			result.Announces++
+			if r.Err != nil {
+				result.Failures++
+			}
+		}
+		for i, t := range soakTorrents {
+			if ctx.Err() != nil || len(swarm.addrs) == 0 {
+				break
+			}
+			result.Downloads++
+			if err := soakDownload(ctx, sess, t, swarm.addrs[i%len(swarm.addrs)]); err != nil {
+				if ctx.Err() != nil {
+					result.Downloads--
+					break
+				}
+				result.DownloadFailures++
+				out.logger().Printf("download of %s failed: %v", t.Info.Name, err)
+			}
+		}
+		if ctx.Err() == nil && time.Since(lastSample) < *sample {
+			continue
+		}
+
+		lastSample = time.Now()
+		s := takeSoakSample(time.Since(start), result.Announces)
+		result.Samples = append(result.Samples, s)
+		fds := "n/a"
+		if s.FDs >= 0 {
+			fds = fmt.Sprint(s.FDs)
+		}
+		out.printf("[%s] %d announces (%d failed), %d downloads (%d failed), heap %s, %d goroutines, %s fds\n",
+			s.Elapsed, s.Announces, result.Failures, result.Downloads, result.DownloadFailures, formatBytes(int64(s.Heap)), s.Goroutines, fds)
+
+		result.Violations = soakViolations(result.Samples[0], s, int64(*maxHeapGrowth)<<20, *maxGoroutines, *maxFDs)
+		if len(result.Violations) > 0 {
+			break
+		}
+	}
+	result.Duration = time.Since(start).Round(time.Second).String()
+	result.Passed = len(result.Violations) == 0
+
+	out.emit(result)
+	if !result.Passed {
+		for _, v := range result.Violations {
+			out.printf("%s\n", colored(colorRed, v))
+		}
+		os.Exit(exitFailure)
+	}
+	out.printf("%s after %s, %d announces (%d failed), %d downloads (%d failed)\n",
+		colored(colorGreen, "Passed"), result.Duration, result.Announces, result.Failures, result.Downloads, result.DownloadFailures)
+}
+
+// takeSoakSample measures the process's resource usage. The heap is
+// measured after a collection, so only live memory counts.
+func takeSoakSample(elapsed time.Duration, announces int) soakSample {
+	runtime.GC()
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	return soakSample{
+		Elapsed:    elapsed.Round(time.Second).String(),
+		Announces:  announces,
+		Heap:       mem.HeapAlloc,
+		Goroutines: runtime.NumGoroutine(),
+		FDs:        openFDs(),
+	}
+}
+
+// soakViolations describes each threshold that s has grown past since base.
+func soakViolations(base, s soakSample, maxHeapGrowth int64, maxGoroutines, maxFDs int) []string {
+	violations := []string{}
+	if growth := int64(s.Heap) - int64(base.Heap); growth > maxHeapGrowth {
+		violations = append(violations, fmt.Sprintf("heap grew by %s, limit %s", formatBytes(growth), formatBytes(maxHeapGrowth)))
+	}
+	if growth := s.Goroutines - base.Goroutines; growth > maxGoroutines {
+		violations = append(violations, fmt.Sprintf("goroutines grew by %d, limit %d", growth, maxGoroutines))
+	}
+	if growth := s.FDs - base.FDs; base.FDs >= 0 && growth > maxFDs {
+		violations = append(violations, fmt.Sprintf("open file descriptors grew by %d, limit %d", growth, maxFDs))
+	}
+	return violations
+}
+
+// openFDs returns the number of open file descriptors, or -1 where they
+// can't be listed.
+func openFDs() int {
+	entries, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		return -1
+	}
+	// One of them is the descriptor used to read the directory.
+	return len(entries) - 1
+}
+
+// soakTorrent builds a synthetic torrent announced to announceURL and
+// returns it with its content.
+func soakTorrent(i int, announceURL string) (*torrent.Torrent, []byte, error) {
+	content := make([]byte, soakPieces*soakPieceLength)
+	rand.Read(content)
+	var pieces []byte
+	for begin := 0; begin < len(content); begin += soakPieceLength {
+		hash := sha1.Sum(content[begin : begin+soakPieceLength])
+		pieces = append(pieces, hash[:]...)
+	}
+	data, err := bencode.Marshal(map[string]any{
+		"announce": announceURL,
+		"info": map[string]any{
+			"name":         fmt.Sprintf("soak-%d", i),
+			"piece length": soakPieceLength,
+			"pieces":       pieces,
+			"length":       len(content),
+		},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	t, err := torrent.NewTorrentFromBencode(data)
+	return t, content, err
+}
+
+// soakDownload downloads every piece of t from the seed at addr and fails
+// unless all of them verify.
+func soakDownload(ctx context.Context, sess *session.Session, t *torrent.Torrent, addr string) error {
+	dialCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	conn, err := sess.DialPeer(dialCtx, addr)
+	cancel()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+
+	st := newSpeedTest(t, conn, 5, 0)
+	if err := st.run(sess.PeerID()); err != nil {
+		return err
+	}
+	if st.failed > 0 {
+		return fmt.Errorf("%d of %d pieces failed verification", st.failed, st.target)
+	}
+	return nil
+}
+
+// soakSwarm is a set of seeds on loopback ports, each serving the content of
+// every torrent added to the swarm.
+type soakSwarm struct {
+	listeners []net.Listener
+	addrs     []string
+	wg        sync.WaitGroup
+
+	mu      sync.Mutex
+	content map[[20]byte][]byte
+	conns   map[net.Conn]struct{}
+}
+
+// startSoakSwarm starts a swarm of n seeds.
+func startSoakSwarm(n int) (*soakSwarm, error) {
+	sw := &soakSwarm{content: make(map[[20]byte][]byte), conns: make(map[net.Conn]struct{})}
+	for i := 0; i < n; i++ {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			sw.close()
+			return nil, err
+		}
+		sw.listeners = append(sw.listeners, ln)
+		sw.addrs = append(sw.addrs, ln.Addr().String())
+		sw.wg.Add(1)
+		go sw.accept(ln)
+	}
+	return sw, nil
+}
+
+// add makes the swarm seed content under infoHash.
+func (sw *soakSwarm) add(infoHash [20]byte, content []byte) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	sw.content[infoHash] = content
+}
+
+// close stops the seeds and waits for their connections to end.
+func (sw *soakSwarm) close() {
+	for _, ln := range sw.listeners {
+		ln.Close()
+	}
+	sw.mu.Lock()
+	for conn := range sw.conns {
+		conn.Close()
+	}
+	sw.mu.Unlock()
+	sw.wg.Wait()
+}
+
+// accept serves the connections to one seed.
+func (sw *soakSwarm) accept(ln net.Listener) {
+	defer sw.wg.Done()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		sw.mu.Lock()
+		sw.conns[conn] = struct{}{}
+		sw.mu.Unlock()
+		sw.wg.Add(1)
+		go func() {
+			defer sw.wg.Done()
+			sw.seed(conn)
+			sw.mu.Lock()
+			delete(sw.conns, conn)
+			sw.mu.Unlock()
+			conn.Close()
+		}()
+	}
+}
+
+// seed answers a peer's handshake, announces every piece and serves the
+// blocks it requests until it disconnects.
+func (sw *soakSwarm) seed(conn net.Conn) {
+	conn.SetDeadline(time.Now().Add(time.Minute))
+	remote, err := peerwire.ReadHandshake(conn)
+	if err != nil {
+		return
+	}
+	sw.mu.Lock()
+	content, ok := sw.content[remote.InfoHash]
+	sw.mu.Unlock()
+	if !ok {
+		return
+	}
+	h := peerwire.Handshake{InfoHash: remote.InfoHash}
+	h.Set(peerwire.FastBit)
+	rand.Read(h.PeerID[:])
+	if err := peerwire.WriteHandshake(conn, h); err != nil {
+		return
+	}
+	fast := remote.Has(peerwire.FastBit)
+	var have peerwire.Message = peerwire.HaveAll{}
+	if !fast {
+		have = peerwire.Bitfield{Bits: []byte{0xff &^ (0xff >> soakPieces)}}
+	}
+	if err := peerwire.WriteMessage(conn, have); err != nil {
+		return
+	}
+	if err := peerwire.WriteMessage(conn, peerwire.Unchoke{}); err != nil {
+		return
+	}
+
+	for {
+		msg, err := peerwire.ReadMessage(conn)
+		if err != nil {
+			return
+		}
+		req, ok := msg.(peerwire.Request)
+		if !ok {
+			continue
+		}
+		start := int64(req.Index)*soakPieceLength + int64(req.Begin)
+		if req.Begin+req.Length > soakPieceLength || req.Length > blockSize || start+int64(req.Length) > int64(len(content)) {
+			if !fast {
+				return
+			}
+			err = peerwire.WriteMessage(conn, peerwire.Reject{Index: req.Index, Begin: req.Begin, Length: req.Length})
+		} else {
+			err = peerwire.WriteMessage(conn, peerwire.Piece{Index: req.Index, Begin: req.Begin, Block: content[start : start+int64(req.Length)]})
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// startSoakTracker serves a tracker on a loopback port that answers every
+// announce with soakPeers random peers. It returns the announce URL and a
+// function stopping the tracker.
+func startSoakTracker() (string, func(), error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", nil, err
+	}
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		peers := make([]byte, soakPeers*6)
+		rand.Read(peers)
+		for i := 0; i < len(peers); i += 6 {
+			// Keep the peers valid: a unicast address outside the reserved ranges and a non-zero port.
+			peers[i] = 10
+			peers[i+4] |= 0x80
+		}
+		resp, err := bencode.Marshal(map[string]any{
+			"interval":   1800,
+			"complete":   soakPeers / 2,
+			"incomplete": soakPeers / 2,
+			"peers":      peers,
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write(resp)
+	})}
+	go srv.Serve(ln)
+	return "http://" + ln.Addr().String() + "/announce", func() { srv.Close() }, nil
+}
@@ -0,0 +1,391 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/ayu-ch/bittorrent-client/pkg/peerwire"
+	"github.com/ayu-ch/bittorrent-client/session"
+	"github.com/ayu-ch/bittorrent-client/torrent"
+)
+
+// blockSize is the size of the blocks requested from peers.
+const blockSize = 16 * 1024
+
+// runSpeedTest downloads pieces of a torrent from a single peer, without any
+// tracker or other peer discovery, and reports throughput, request latency
+// and how full the request pipeline was kept. Data is verified and discarded.
+// Without -peer, the peers the torrent's last announce returned are tried in
+// turn and the first that accepts the connection is used.
+//
+// Usage:
+//
+//	speedtest [-peer host:port] [-state-dir DIR] [-pipeline N] [-pieces N] [-timeout D] [-json|-quiet] <file.torrent>
+func runSpeedTest(args []string) {
+	fs := flag.NewFlagSet("speedtest", flag.ExitOnError)
+	peerAddr := fs.String("peer", "", "address of the seed to download from, instead of a peer from the last announce")
+	stateDir := fs.String("state-dir", "", "directory holding the peers of earlier announces (default: the platform state directory)")
+	pipeline := fs.Int("pipeline", 5, "number of outstanding block requests")
+	maxPieces := fs.Int("pieces", 0, "number of pieces to download, 0 for all")
+	timeout := fs.Duration("timeout", 5*time.Minute, "give up after this long")
+	out := addOutputFlags(fs)
+	fs.Parse(args)
+
+	if fs.NArg() != 1 || *pipeline < 1 {
+		fmt.Fprintln(os.Stderr, "Usage: speedtest [-peer host:port] [-state-dir DIR] [-pipeline N] [-pieces N] [-timeout D] [-json|-quiet] <file.torrent>")
+		os.Exit(exitUsage)
+	}
+
+	t, err := torrent.NewTorrent(fs.Arg(0))
+	if err != nil {
+		fatalf(exitTorrent, "failed to create Torrent object: %v", err)
+	}
+	var opts []session.Option
+	if *peerAddr == "" {
+		if *stateDir == "" {
+			dir, err := session.DefaultStateDir()
+			if err != nil {
+				fatalf(exitFailure, "failed to find a state directory, use -state-dir or -peer: %v", err)
+			}
+			*stateDir = dir
+		}
+		opts = append(opts, session.WithReadOnlyStateDir(*stateDir), session.WithLogger(out.logger()))
+	}
+	sess, err := session.NewSession(opts...)
+	if err != nil {
+		fatalf(exitFailure, "failed to create session: %v", err)
+	}
+
+	addrs := []string{*peerAddr}
+	if *peerAddr == "" {
+		addrs = nil
+		for _, p := range sess.KnownPeers(t) {
+			addrs = append(addrs, p.String())
+		}
+		if len(addrs) == 0 {
+			fatalf(exitUsage, "no peers known for %s, announce it first or use -peer", t.Info.Name)
+		}
+	}
+	conn, err := dialFirst(sess, addrs)
+	if err != nil {
+		fatalf(exitNetwork, "%v", err)
+	}
+	defer conn.Close()
+	out.printf("Connected to %s\n", conn.RemoteAddr())
+	conn.SetDeadline(time.Now().Add(*timeout))
+
+	st := newSpeedTest(t, conn, *pipeline, *maxPieces)
+	err = st.run(sess.PeerID())
+	if err != nil && !out.quiet {
+		warnf("speed test stopped: %v", err)
+	}
+	st.report(out)
+	if err != nil {
+		os.Exit(exitNetwork)
+	}
+}
+
+// dialFirst connects to each of addrs in turn and returns the first
+// connection made.
+func dialFirst(sess *session.Session, addrs []string) (net.Conn, error) {
+	var err error
+	for _, addr := range addrs {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		var conn net.Conn
+		conn, err = sess.DialPeer(ctx, addr)
+		cancel()
+		if err == nil {
+			return conn, nil
+		}
+		err = fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+	return nil, err
+}
+
+// blockRef identifies a requested block.
+type blockRef struct {
+	index, begin uint32
+}
+
+// speedTest is the state of a single-peer download.
+type speedTest struct {
+	t         *torrent.Torrent
+	conn      net.Conn
+	pipeline  int
+	maxPieces int
+
+	have   []bool
+	choked bool
+	// fast is set when both sides support the fast extension (BEP 6), so a
+	// choke doesn't drop requests; each is answered with a block or a reject.
+	fast     bool
+	queue    []peerwire.Request
+	queued   bool
+	pending  map[blockRef]time.Time
+	buffers  map[uint32][]byte
+	received map[uint32]int64
+
+	start, end    time.Time
+	bytes         int64
+	verified      int
+	failed        int
+	target        int
+	latencies     []time.Duration
+	lastEvent     time.Time
+	pipelineTotal time.Duration // sum of outstanding requests times the time they were outstanding
+}
+
+// newSpeedTest prepares a download of up to maxPieces pieces of t, or all of
+// them if maxPieces is 0, over conn.
+func newSpeedTest(t *torrent.Torrent, conn net.Conn, pipeline, maxPieces int) *speedTest {
+	return &speedTest{
+		t:         t,
+		conn:      conn,
+		pipeline:  pipeline,
+		maxPieces: maxPieces,
+		have:      make([]bool, len(t.Info.Pieces)),
+		pending:   make(map[blockRef]time.Time),
+		buffers:   make(map[uint32][]byte),
+		received:  make(map[uint32]int64),
+	}
+}
+
+// run performs the handshake and downloads until the target pieces are done.
+func (st *speedTest) run(peerID [20]byte) error {
+	h := peerwire.Handshake{InfoHash: st.t.InfoHash, PeerID: peerID}
+	h.Set(peerwire.FastBit)
+	if err := peerwire.WriteHandshake(st.conn, h); err != nil {
+		return fmt.Errorf("failed to send handshake: %w", err)
+	}
+	remote, err := peerwire.ReadHandshake(st.conn)
+	if err != nil {
+		return fmt.Errorf("failed to read handshake: %w", err)
+	}
+	if remote.InfoHash != st.t.InfoHash {
+		return fmt.Errorf("peer answered with info hash %x", remote.InfoHash)
+	}
+	st.fast = remote.Has(peerwire.FastBit)
+	if err := peerwire.WriteMessage(st.conn, peerwire.Interested{}); err != nil {
+		return err
+	}
+
+	st.choked = true
+	st.start = time.Now()
+	st.lastEvent = st.start
+	defer func() { st.end = time.Now() }()
+
+	for {
+		msg, err := peerwire.ReadMessage(st.conn)
+		if err != nil {
+			return err
+		}
+		st.account()
+
+		switch m := msg.(type) {
+		case peerwire.Bitfield:
+			for i := range st.have {
+				st.have[i] = i/8 < len(m.Bits) && m.Bits[i/8]&(0x80>>(i%8)) != 0
+			}
+		case peerwire.HaveAll:
+			for i := range st.have {
+				st.have[i] = true
+			}
+		case peerwire.Have:
+			if int(m.Index) < len(st.have) {
+				st.have[m.Index] = true
+			}
+		case peerwire.Choke:
+			st.choked = true
+			if !st.fast {
+				st.requeuePending()
+			}
+		case peerwire.Unchoke:
+			st.choked = false
+		case peerwire.Reject:
+			ref := blockRef{m.Index, m.Begin}
+			if _, ok := st.pending[ref]; ok {
+				delete(st.pending, ref)
+				st.queue = append(st.queue, peerwire.Request{Index: m.Index, Begin: m.Begin, Length: m.Length})
+			}
+		case peerwire.Piece:
+			if err := st.receive(m); err != nil {
+				return err
+			}
+			if st.queued && st.verified+st.failed == st.target {
+				return nil
+			}
+		}
+
+		if !st.choked {
+			if err := st.fillPipeline(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// fillPipeline sends requests until the pipeline is full.
+func (st *speedTest) fillPipeline() error {
+	if !st.queued {
+		st.queueRequests()
+		if st.target == 0 {
+			return fmt.Errorf("peer has none of the pieces")
+		}
+	}
+	for len(st.pending) < st.pipeline && len(st.queue) > 0 {
+		req := st.queue[0]
+		st.queue = st.queue[1:]
+		if err := peerwire.WriteMessage(st.conn, req); err != nil {
+			return err
+		}
+		st.pending[blockRef{req.Index, req.Begin}] = time.Now()
+	}
+	return nil
+}
+
+// queueRequests queues block requests for the pieces the peer has, up to the piece limit.
+func (st *speedTest) queueRequests() {
+	st.queued = true
+	for i, has := range st.have {
+		if !has {
+			continue
+		}
+		if st.maxPieces > 0 && st.target == st.maxPieces {
+			break
+		}
+		st.target++
+		size := st.t.Info.PieceSize(i)
+		for begin := int64(0); begin < size; begin += blockSize {
+			length := min(blockSize, size-begin)
+			st.queue = append(st.queue, peerwire.Request{Index: uint32(i), Begin: uint32(begin), Length: uint32(length)})
+		}
+	}
+}
+
+// blockLength returns the length requested for the block at ref.
+func (st *speedTest) blockLength(ref blockRef) int64 {
+	return min(blockSize, st.t.Info.PieceSize(int(ref.index))-int64(ref.begin))
+}
+
+// requeuePending puts requests dropped by a choke back at the front of the
+// queue. Only peers without the fast extension drop requests when choking.
+func (st *speedTest) requeuePending() {
+	var dropped []peerwire.Request
+	for ref := range st.pending {
+		dropped = append(dropped, peerwire.Request{Index: ref.index, Begin: ref.begin, Length: uint32(st.blockLength(ref))})
+	}
+	slices.SortFunc(dropped, func(a, b peerwire.Request) int {
+		if a.Index != b.Index {
+			return int(a.Index) - int(b.Index)
+		}
+		return int(a.Begin) - int(b.Begin)
+	})
+	st.queue = append(dropped, st.queue...)
+	clear(st.pending)
+}
+
+// receive records a block and verifies its piece once complete.
+func (st *speedTest) receive(m peerwire.Piece) error {
+	ref := blockRef{m.Index, m.Begin}
+	sent, ok := st.pending[ref]
+	if !ok {
+		return nil // unrequested or already requeued after a choke
+	}
+	if want := st.blockLength(ref); int64(len(m.Block)) != want {
+		return fmt.Errorf("peer sent %d bytes at %d of piece %d, requested %d", len(m.Block), m.Begin, m.Index, want)
+	}
+	delete(st.pending, ref)
+	st.latencies = append(st.latencies, time.Since(sent))
+	st.bytes += int64(len(m.Block))
+
+	size := st.t.Info.PieceSize(int(m.Index))
+	buf, ok := st.buffers[m.Index]
+	if !ok {
+		buf = make([]byte, size)
+		st.buffers[m.Index] = buf
+	}
+	copy(buf[m.Begin:], m.Block)
+	st.received[m.Index] += int64(len(m.Block))
+
+	if st.received[m.Index] == size {
+		hash := sha1.Sum(buf)
+		if bytes.Equal(hash[:], st.t.Info.Pieces[m.Index][:]) {
+			st.verified++
+		} else {
+			st.failed++
+		}
+		delete(st.buffers, m.Index)
+		delete(st.received, m.Index)
+	}
+	return nil
+}
+
+// account adds the time since the last event, weighted by the requests outstanding during it.
+func (st *speedTest) account() {
+	now := time.Now()
+	st.pipelineTotal += time.Duration(len(st.pending)) * now.Sub(st.lastEvent)
+	st.lastEvent = now
+}
+
+// speedTestResult is the JSON form of the speed test report. Latencies are
+// in microseconds and only set if at least one block arrived.
+type speedTestResult struct {
+	PiecesVerified   int     `json:"pieces_verified"`
+	PiecesFailed     int     `json:"pieces_failed"`
+	PiecesRequested  int     `json:"pieces_requested"`
+	Bytes            int64   `json:"bytes"`
+	DurationMS       int64   `json:"duration_ms"`
+	BytesPerSecond   int64   `json:"bytes_per_second"`
+	LatencyP50US     int64   `json:"latency_p50_us,omitempty"`
+	LatencyP90US     int64   `json:"latency_p90_us,omitempty"`
+	LatencyP99US     int64   `json:"latency_p99_us,omitempty"`
+	LatencyMaxUS     int64   `json:"latency_max_us,omitempty"`
+	Pipeline         int     `json:"pipeline"`
+	PipelineUtilized float64 `json:"pipeline_utilization"`
+}
+
+// report prints the results of the test.
+func (st *speedTest) report(out *output) {
+	elapsed := st.end.Sub(st.start)
+	if elapsed <= 0 {
+		out.emit(speedTestResult{PiecesRequested: st.target, Pipeline: st.pipeline})
+		out.printf("No data transferred\n")
+		return
+	}
+
+	result := speedTestResult{
+		PiecesVerified:   st.verified,
+		PiecesFailed:     st.failed,
+		PiecesRequested:  st.target,
+		Bytes:            st.bytes,
+		DurationMS:       elapsed.Milliseconds(),
+		BytesPerSecond:   int64(float64(st.bytes) / elapsed.Seconds()),
+		Pipeline:         st.pipeline,
+		PipelineUtilized: float64(st.pipelineTotal) / float64(elapsed) / float64(st.pipeline),
+	}
+	out.printf("Pieces:      %d verified, %d failed, %d requested\n", st.verified, st.failed, st.target)
+	out.printf("Downloaded:  %s in %v\n", formatBytes(st.bytes), elapsed.Round(time.Millisecond))
+	out.printf("Throughput:  %s/s\n", formatBytes(result.BytesPerSecond))
+
+	if len(st.latencies) > 0 {
+		slices.Sort(st.latencies)
+		percentile := func(p float64) time.Duration {
+			return st.latencies[int(p*float64(len(st.latencies)-1))].Round(time.Microsecond)
+		}
+		p50, p90, p99 := percentile(0.5), percentile(0.9), percentile(0.99)
+		maxLatency := st.latencies[len(st.latencies)-1].Round(time.Microsecond)
+		result.LatencyP50US, result.LatencyP90US = p50.Microseconds(), p90.Microseconds()
+		result.LatencyP99US, result.LatencyMaxUS = p99.Microseconds(), maxLatency.Microseconds()
+		out.printf("Latency:     p50 %v, p90 %v, p99 %v, max %v\n", p50, p90, p99, maxLatency)
+	}
+
+	out.printf("Pipeline:    %.0f%% of %d requests in flight on average\n", result.PipelineUtilized*100, st.pipeline)
+	out.emit(result)
+}
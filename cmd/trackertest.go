@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ayu-ch/bittorrent-client/session"
+	"github.com/ayu-ch/bittorrent-client/torrent"
+)
+
+// trackerTestResult is the JSON form of tracker-test's output.
+type trackerTestResult struct {
+	InfoHash string              `json:"info_hash"`
+	Trackers []trackerTestReport `json:"trackers"`
+}
+
+// trackerTestReport is the outcome of announcing to and scraping one tracker.
+// Counts are only set when the corresponding request succeeded.
+type trackerTestReport struct {
+	URL      string `json:"url"`
+	Announce struct {
+		DurationMS int64  `json:"duration_ms"`
+		Error      string `json:"error,omitempty"`
+		Peers      int    `json:"peers"`
+		Seeders    int    `json:"seeders"`
+		Leechers   int    `json:"leechers"`
+		Interval   int    `json:"interval"`
+		// StopError is set when the closing stopped announce failed.
+		StopError string `json:"stop_error,omitempty"`
+	} `json:"announce"`
+	Scrape struct {
+		DurationMS int64  `json:"duration_ms"`
+		Error      string `json:"error,omitempty"`
+		Seeders    int    `json:"seeders"`
+		Leechers   int    `json:"leechers"`
+		Downloads  int    `json:"downloads"`
+	} `json:"scrape"`
+}
+
+// runTrackerTest announces to and scrapes every tracker of a torrent, reporting latency and peer counts.
+// Trackers that accepted the announce get a stopped announce afterwards, so
+// the test doesn't leave us listed in the swarm.
+//
+// Usage:
+//
+//	tracker-test [-port N] [-json|-quiet] <file.torrent>
+//	tracker-test [-port N] [-length N] [-json|-quiet] <tracker-url> <infohash>
+func runTrackerTest(args []string) {
+	fs := flag.NewFlagSet("tracker-test", flag.ExitOnError)
+	port := fs.Uint("port", 6881, "port to report in announces")
+	length := fs.Int64("length", 1, "bytes left to report when testing a bare infohash; trackers may ignore announces with none left")
+	out := addOutputFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: tracker-test [-port N] [-json|-quiet] <file.torrent>")
+		fmt.Fprintln(fs.Output(), "       tracker-test [-port N] [-length N] [-json|-quiet] <tracker-url> <infohash>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if err := checkPort(*port); err != nil {
+		fatalf(exitUsage, "%v", err)
+	}
+	if *length < 1 {
+		fatalf(exitUsage, "invalid length %d: must be at least 1", *length)
+	}
+
+	var t *torrent.Torrent
+	switch fs.NArg() {
+	case 1:
+		var err error
+		t, err = torrent.NewTorrent(fs.Arg(0))
+		if err != nil {
+			fatalf(exitTorrent, "failed to create Torrent object: %v", err)
+		}
+	case 2:
+		infoHash, err := parseInfoHash(fs.Arg(1))
+		if err != nil {
+			fatalf(exitUsage, "invalid infohash: %v", err)
+		}
+		t = &torrent.Torrent{Announce: fs.Arg(0), InfoHash: infoHash, Info: torrent.Info{Length: *length}}
+	default:
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+
+	sess, err := session.NewSession(session.WithListenPort(uint16(*port)))
+	if err != nil {
+		fatalf(exitFailure, "failed to create session: %v", err)
+	}
+
+	trackers := t.Trackers()
+	if len(trackers) == 0 {
+		fatalf(exitTorrent, "torrent has no trackers")
+	}
+
+	result := trackerTestResult{InfoHash: fmt.Sprintf("%x", t.InfoHash)}
+	out.printf("Info hash: %s\n", result.InfoHash)
+	failed := 0
+	for _, tracker := range trackers {
+		report := trackerTestReport{URL: tracker}
+		out.printf("\n%s\n", tracker)
+
+		start := time.Now()
+		resp, err := sess.AnnounceTo(context.Background(), t, tracker)
+		elapsed := time.Since(start).Round(time.Millisecond)
+		report.Announce.DurationMS = elapsed.Milliseconds()
+		if err != nil {
+			failed++
+			report.Announce.Error = err.Error()
+			out.printf("  announce: %s after %v: %v\n", colored(colorRed, "error"), elapsed, err)
+		} else {
+			report.Announce.Peers = len(resp.Peers)
+			report.Announce.Seeders = resp.Complete
+			report.Announce.Leechers = resp.Incomplete
+			report.Announce.Interval = resp.Interval
+			out.printf("  announce: %v, %d peers, %d seeders, %d leechers, interval %ds\n",
+				elapsed, len(resp.Peers), resp.Complete, resp.Incomplete, resp.Interval)
+		}
+
+		start = time.Now()
+		scrape, err := sess.Scrape(context.Background(), t, tracker)
+		elapsed = time.Since(start).Round(time.Millisecond)
+		report.Scrape.DurationMS = elapsed.Milliseconds()
+		if err != nil {
+			report.Scrape.Error = err.Error()
+			out.printf("  scrape:   %s after %v: %v\n", colored(colorRed, "error"), elapsed, err)
+		} else {
+			report.Scrape.Seeders = scrape.Complete
+			report.Scrape.Leechers = scrape.Incomplete
+			report.Scrape.Downloads = scrape.Downloaded
+			out.printf("  scrape:   %v, %d seeders, %d leechers, %d downloads\n",
+				elapsed, scrape.Complete, scrape.Incomplete, scrape.Downloaded)
+		}
+
+		if report.Announce.Error == "" {
+			if err := sess.AnnounceStopped(context.Background(), t, tracker); err != nil {
+				report.Announce.StopError = err.Error()
+				out.printf("  stopped:  %s: %v\n", colored(colorRed, "error"), err)
+			}
+		}
+		result.Trackers = append(result.Trackers, report)
+	}
+	out.emit(result)
+
+	if failed == len(trackers) {
+		os.Exit(exitNetwork)
+	}
+}
+
+// checkPort rejects ports that can't be reported to trackers.
+func checkPort(port uint) error {
+	if port < 1 || port > 65535 {
+		return fmt.Errorf("invalid port %d: must be between 1 and 65535", port)
+	}
+	return nil
+}
+
+// parseInfoHash decodes a 40 character hex infohash.
+func parseInfoHash(s string) ([20]byte, error) {
+	var infoHash [20]byte
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return infoHash, err
+	}
+	if len(b) != len(infoHash) {
+		return infoHash, fmt.Errorf("expected 20 bytes, got %d", len(b))
+	}
+	copy(infoHash[:], b)
+	return infoHash, nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ayu-ch/bittorrent-client/torrent"
+)
+
+// verifyResult is the JSON form of verify's output.
+type verifyResult struct {
+	InfoHash string       `json:"info_hash"`
+	Pieces   int          `json:"pieces"`
+	Verified int          `json:"verified"`
+	Files    []verifyFile `json:"files"`
+}
+
+// verifyFile is the completion of one file, between 0 and 1.
+type verifyFile struct {
+	Path       string  `json:"path"`
+	Size       int64   `json:"size"`
+	Completion float64 `json:"completion"`
+}
+
+// runVerify checks which pieces of a torrent are already present in a local
+// directory, such as a mirror or a partial copy of the content, and exits
+// with status 1 unless all of them are.
+//
+// Usage:
+//
+//	verify [-json|-quiet] <file.torrent> <dir>
+func runVerify(args []string) {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	out := addOutputFlags(fs)
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fmt.Fprintln(os.Stderr, "Usage: verify [-json|-quiet] <file.torrent> <dir>")
+		os.Exit(exitUsage)
+	}
+
+	t, err := torrent.NewTorrent(fs.Arg(0))
+	if err != nil {
+		fatalf(exitTorrent, "failed to create Torrent object: %v", err)
+	}
+	verified, err := t.Info.VerifyDir(fs.Arg(1))
+	if err != nil {
+		fatalf(exitFailure, "failed to verify %s: %v", fs.Arg(1), err)
+	}
+
+	result := verifyResult{InfoHash: fmt.Sprintf("%x", t.InfoHash), Pieces: len(verified)}
+	for _, ok := range verified {
+		if ok {
+			result.Verified++
+		}
+	}
+	completion := t.Info.FileCompletion(verified)
+	for i, f := range t.Info.FileExtents() {
+		result.Files = append(result.Files, verifyFile{Path: strings.Join(f.Path, "/"), Size: f.Length, Completion: completion[i]})
+	}
+	out.emit(result)
+
+	out.printf("Verified %d of %d pieces\n", result.Verified, result.Pieces)
+	out.printf("\n%6s  %10s  %s\n", "Done", "Size", "Path")
+	for _, f := range result.Files {
+		out.printf("%5.1f%%  %10s  %s\n", f.Completion*100, formatBytes(f.Size), f.Path)
+	}
+	if result.Verified < result.Pieces {
+		os.Exit(exitFailure)
+	}
+}
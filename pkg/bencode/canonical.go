@@ -0,0 +1,125 @@
+package bencode
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Valid reports whether data is a single value in canonical Bencode: integers
+// without leading zeros or negative zero, string lengths without leading
+// zeros, and dictionary keys in strictly increasing order. Data that isn't
+// canonical would hash differently once re-encoded, which matters for the
+// info dictionary of a torrent.
+func Valid(data []byte) bool {
+	end, ok := validValue(data, 0)
+	return ok && end == len(data)
+}
+
+// Canonicalize decodes data and re-encodes it canonically.
+func Canonicalize(data []byte) ([]byte, error) {
+	reader := bytes.NewReader(data)
+	v, err := unmarshalValue(reader, false)
+	if err != nil {
+		return nil, err
+	}
+	if reader.Len() != 0 {
+		return nil, fmt.Errorf("%d bytes of trailing data", reader.Len())
+	}
+	return Marshal(v)
+}
+
+// validValue checks the value starting at data[i] and returns the index just past it.
+func validValue(data []byte, i int) (int, bool) {
+	if i >= len(data) {
+		return 0, false
+	}
+	switch data[i] {
+	case 'i':
+		return validInt(data, i+1)
+	case 'l':
+		i++
+		for i < len(data) && data[i] != 'e' {
+			var ok bool
+			if i, ok = validValue(data, i); !ok {
+				return 0, false
+			}
+		}
+		if i >= len(data) {
+			return 0, false
+		}
+		return i + 1, true
+	case 'd':
+		i++
+		var prev []byte
+		first := true
+		for i < len(data) && data[i] != 'e' {
+			start, end, ok := validString(data, i)
+			if !ok {
+				return 0, false
+			}
+			key := data[start:end]
+			if !first && bytes.Compare(prev, key) >= 0 {
+				return 0, false
+			}
+			prev, first = key, false
+			if i, ok = validValue(data, end); !ok {
+				return 0, false
+			}
+		}
+		if i >= len(data) {
+			return 0, false
+		}
+		return i + 1, true
+	default:
+		_, end, ok := validString(data, i)
+		return end, ok
+	}
+}
+
+// validInt checks the digits of an integer starting after its 'i' and returns the index past its 'e'.
+func validInt(data []byte, i int) (int, bool) {
+	negative := i < len(data) && data[i] == '-'
+	if negative {
+		i++
+	}
+	end, ok := validDigits(data, i)
+	if !ok || end >= len(data) || data[end] != 'e' {
+		return 0, false
+	}
+	if negative && data[i] == '0' {
+		return 0, false
+	}
+	return end + 1, true
+}
+
+// validString checks a string starting at data[i] and returns the bounds of its contents.
+func validString(data []byte, i int) (int, int, bool) {
+	end, ok := validDigits(data, i)
+	if !ok || end >= len(data) || data[end] != ':' {
+		return 0, 0, false
+	}
+	length := 0
+	for _, ch := range data[i:end] {
+		length = length*10 + int(ch-'0')
+		if length > len(data) {
+			return 0, 0, false
+		}
+	}
+	start := end + 1
+	if length > len(data)-start {
+		return 0, 0, false
+	}
+	return start, start + length, true
+}
+
+// validDigits checks a run of decimal digits without leading zeros and returns the index past it.
+func validDigits(data []byte, i int) (int, bool) {
+	start := i
+	for i < len(data) && data[i] >= '0' && data[i] <= '9' {
+		i++
+	}
+	if i == start || (data[start] == '0' && i-start > 1) {
+		return 0, false
+	}
+	return i, true
+}
@@ -0,0 +1,86 @@
+package bencode
+
+import "testing"
+
+func TestValid(t *testing.T) {
+	tests := []struct {
+		data string
+		want bool
+	}{
+		{"i0e", true},
+		{"i-1e", true},
+		{"i42e", true},
+		{"0:", true},
+		{"4:spam", true},
+		{"le", true},
+		{"de", true},
+		{"l4:spami3ee", true},
+		{"d3:bar4:spam3:fooi42ee", true},
+		{"d1:ad1:bi1e1:ci2eee", true},
+
+		{"d3:foo0:3:bar0:e", false}, // unsorted keys
+		{"d3:foo0:3:foo0:e", false}, // duplicate keys
+		{"d1:ad1:ci1e1:bi2eee", false},
+		{"i03e", false},
+		{"i-0e", false},
+		{"i-03e", false},
+		{"ie", false},
+		{"i-e", false},
+		{"04:spam", false},
+		{"5:spam", false}, // truncated string
+		{"4:spa", false},
+		{"i1", false},
+		{"l4:spam", false},
+		{"d3:foo", false},
+		{"d3:fooe", false},
+		{"di1ei2ee", false},
+		{"i1ei2e", false}, // trailing data
+		{"4:spamx", false},
+		{"", false},
+		{"x", false},
+	}
+	for _, tt := range tests {
+		if got := Valid([]byte(tt.data)); got != tt.want {
+			t.Errorf("Valid(%q) = %v, want %v", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestCanonicalize(t *testing.T) {
+	tests := []struct {
+		data, want string
+	}{
+		{"d3:foo0:3:bar0:e", "d3:bar0:3:foo0:e"},
+		{"d3:fooi1e3:fooi2ee", "d3:fooi2ee"},
+		{"i03e", "i3e"},
+		{"i-0e", "i0e"},
+		{"04:spam", "4:spam"},
+		{"ld1:bi1e1:ai2eee", "ld1:ai2e1:bi1eee"},
+		{"d3:bar4:spam3:fooi42ee", "d3:bar4:spam3:fooi42ee"},
+	}
+	for _, tt := range tests {
+		got, err := Canonicalize([]byte(tt.data))
+		if err != nil {
+			t.Errorf("Canonicalize(%q): %v", tt.data, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("Canonicalize(%q) = %q, want %q", tt.data, got, tt.want)
+		}
+		if !Valid(got) {
+			t.Errorf("Canonicalize(%q) = %q, which isn't valid", tt.data, got)
+		}
+		again, err := Canonicalize(got)
+		if err != nil || string(again) != string(got) {
+			t.Errorf("Canonicalize(%q) = %q, %v, want it unchanged", got, again, err)
+		}
+	}
+}
+
+func TestCanonicalizeInvalid(t *testing.T) {
+	for _, data := range []string{"5:spam", "i1", "l4:spam", "d3:foo", "i1ei2e", "4:spamx", ""} {
+		if got, err := Canonicalize([]byte(data)); err == nil {
+			t.Errorf("Canonicalize(%q) = %q, want error", data, got)
+		}
+	}
+}
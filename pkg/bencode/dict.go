@@ -0,0 +1,22 @@
+package bencode
+
+// Dict is a dictionary that keeps its entries in order. Marshal writes the
+// entries in the order given rather than sorting them, so a Dict decoded by
+// UnmarshalOrdered re-encodes to the same bytes it was read from.
+type Dict []DictEntry
+
+// DictEntry is a single key and value of a Dict.
+type DictEntry struct {
+	Key   string
+	Value any
+}
+
+// Get returns the value of the last entry with the given key.
+func (d Dict) Get(key string) (any, bool) {
+	for i := len(d) - 1; i >= 0; i-- {
+		if d[i].Key == key {
+			return d[i].Value, true
+		}
+	}
+	return nil, false
+}
@@ -1,12 +1,39 @@
 package bencode
 
 import (
+	"bufio"
 	"bytes"
 	"fmt"
+	"io"
+	"reflect"
 	"sort"
 	"strconv"
 )
 
+// Bytes is a byte string that is encoded as it is, without being copied
+// into a string first.
+type Bytes []byte
+
+// Reader is a byte string of Size bytes that is read from R while encoding.
+// Used with an Encoder, large values such as piece layers or metadata blobs
+// stream straight to the output instead of being held in memory.
+type Reader struct {
+	R    io.Reader
+	Size int64
+}
+
+// writer is what values are encoded to; both bytes.Buffer and bufio.Writer
+// implement it. Write errors are sticky in both, so they are checked once
+// encoding is done rather than after every write.
+type writer interface {
+	io.Writer
+	io.StringWriter
+	WriteRune(r rune) (int, error)
+}
+
+// Marshal returns the bencoding of v. Besides the basic types and Dict,
+// structs, maps with string keys, slices and arrays are encoded the way
+// Unmarshal decodes them.
 func Marshal(v any) ([]byte, error) {
 	var buf bytes.Buffer
 	if err := marshalValue(v, &buf); err != nil {
@@ -15,46 +42,94 @@ func Marshal(v any) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
-func marshalValue(v any, b *bytes.Buffer) error {
+// Encoder writes bencoded values to an output stream.
+type Encoder struct {
+	w *bufio.Writer
+}
+
+// NewEncoder returns an encoder writing to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: bufio.NewWriter(w)}
+}
+
+// Encode writes the encoding of v.
+func (e *Encoder) Encode(v any) error {
+	if err := marshalValue(v, e.w); err != nil {
+		return err
+	}
+	return e.w.Flush()
+}
+
+func marshalValue(v any, b writer) error {
 	switch value := v.(type) {
 	case int:
+		marshalInt(int64(value), b)
+	case int64:
 		marshalInt(value, b)
 
 	case string:
 		marshalString(value, b)
+	case []byte:
+		marshalBytes(value, b)
+	case Bytes:
+		marshalBytes(value, b)
+	case Reader:
+		return marshalReader(value, b)
 	case []any:
-		marshalList(value, b)
+		return marshalList(value, b)
 	case map[string]any:
-		marshalDict(value, b)
+		return marshalDict(value, b)
+	case Dict:
+		return marshalOrderedDict(value, b)
 	default:
-		return fmt.Errorf("Unsupported type:%T", v)
+		return marshalReflect(reflect.ValueOf(v), b)
 	}
 	return nil
 }
 
-func marshalInt(v int, b *bytes.Buffer) {
+func marshalInt(v int64, b writer) {
 	b.WriteRune('i')
-	b.WriteString(strconv.Itoa(v))
+	b.WriteString(strconv.FormatInt(v, 10))
 	b.WriteRune('e')
 }
 
-func marshalString(s string, b *bytes.Buffer) {
+func marshalString(s string, b writer) {
 	b.WriteString(strconv.Itoa(len(s)))
 	b.WriteRune(':')
 	b.WriteString(s)
 }
 
-func marshalList(list []any, b *bytes.Buffer) {
+func marshalBytes(s []byte, b writer) {
+	b.WriteString(strconv.Itoa(len(s)))
+	b.WriteRune(':')
+	b.Write(s)
+}
+
+func marshalReader(r Reader, b writer) error {
+	if r.Size < 0 {
+		return fmt.Errorf("negative byte string size %d", r.Size)
+	}
+	b.WriteString(strconv.FormatInt(r.Size, 10))
+	b.WriteRune(':')
+	n, err := io.CopyN(b, r.R, r.Size)
+	if err == io.EOF {
+		return fmt.Errorf("byte string reader ended after %d of %d bytes", n, r.Size)
+	}
+	return err
+}
+
+func marshalList(list []any, b writer) error {
 	b.WriteRune('l')
 	for _, item := range list {
 		if err := marshalValue(item, b); err != nil {
-			return
+			return err
 		}
 	}
 	b.WriteRune('e')
+	return nil
 }
 
-func marshalDict(dict map[string]any, buf *bytes.Buffer) {
+func marshalDict(dict map[string]any, buf writer) error {
 	buf.WriteRune('d')
 	keys := make([]string, 0, len(dict))
 	for k := range dict {
@@ -65,8 +140,21 @@ func marshalDict(dict map[string]any, buf *bytes.Buffer) {
 	for _, k := range keys {
 		marshalString(k, buf)
 		if err := marshalValue(dict[k], buf); err != nil {
-			return
+			return err
 		}
 	}
 	buf.WriteRune('e')
+	return nil
+}
+
+func marshalOrderedDict(dict Dict, buf writer) error {
+	buf.WriteRune('d')
+	for _, entry := range dict {
+		marshalString(entry.Key, buf)
+		if err := marshalValue(entry.Value, buf); err != nil {
+			return err
+		}
+	}
+	buf.WriteRune('e')
+	return nil
 }
@@ -0,0 +1,96 @@
+package bencode
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestEncoderMatchesMarshal(t *testing.T) {
+	values := []any{
+		int64(-42),
+		"spam",
+		[]byte("raw"),
+		Bytes("raw"),
+		[]any{"a", int64(1), []any{}},
+		map[string]any{"b": "x", "a": Bytes{0, 1, 2}},
+		Dict{{Key: "z", Value: int64(1)}, {Key: "a", Value: "x"}},
+		struct {
+			Name   string `bencode:"name"`
+			Length int64  `bencode:"length"`
+		}{"file", 5 << 30},
+		map[string]any{"piece layers": Bytes(bytes.Repeat([]byte{7}, 10000))},
+	}
+	for _, v := range values {
+		want, err := Marshal(v)
+		if err != nil {
+			t.Fatalf("Marshal(%v): %v", v, err)
+		}
+		var buf bytes.Buffer
+		if err := NewEncoder(&buf).Encode(v); err != nil {
+			t.Fatalf("Encode(%v): %v", v, err)
+		}
+		if !bytes.Equal(buf.Bytes(), want) {
+			t.Errorf("Encode(%v) = %q, want %q", v, buf.Bytes(), want)
+		}
+	}
+}
+
+func TestEncoderReader(t *testing.T) {
+	data := strings.Repeat("0123456789", 10000)
+	v := map[string]any{
+		"blob": Reader{R: iotest.OneByteReader(strings.NewReader(data)), Size: int64(len(data))},
+		"name": "x",
+	}
+	want, err := Marshal(map[string]any{"blob": data, "name": "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(v); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("Encode with a Reader differs from Marshal of the same string")
+	}
+}
+
+func TestReaderSizeMismatch(t *testing.T) {
+	if _, err := Marshal(Reader{R: strings.NewReader("spam"), Size: 5}); err == nil {
+		t.Error("Marshal of a Reader shorter than its Size succeeded")
+	}
+	if _, err := Marshal(Reader{R: strings.NewReader("spam"), Size: -1}); err == nil {
+		t.Error("Marshal of a Reader with a negative Size succeeded")
+	}
+	// A longer reader is only read up to Size, keeping the encoding well formed.
+	got, err := Marshal([]any{Reader{R: strings.NewReader("spam and eggs"), Size: 4}})
+	if err != nil || string(got) != "l4:spame" {
+		t.Errorf("Marshal of a Reader longer than its Size = %q, %v, want %q", got, err, "l4:spame")
+	}
+}
+
+// failingWriter fails every write.
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errFailingWriter
+}
+
+var errFailingWriter = errors.New("write failed")
+
+func TestEncoderErrors(t *testing.T) {
+	errRead := errors.New("read failed")
+	v := Dict{{Key: "blob", Value: Reader{R: iotest.ErrReader(errRead), Size: 4}}}
+	if err := NewEncoder(io.Discard).Encode(v); !errors.Is(err, errRead) {
+		t.Errorf("Encode with a failing Reader = %v, want %v", err, errRead)
+	}
+	if err := NewEncoder(failingWriter{}).Encode("spam"); !errors.Is(err, errFailingWriter) {
+		t.Errorf("Encode to a failing writer = %v, want %v", err, errFailingWriter)
+	}
+	if err := NewEncoder(io.Discard).Encode([]any{func() {}}); err == nil {
+		t.Error("Encode of an unsupported type succeeded")
+	}
+}
@@ -0,0 +1,330 @@
+package bencode
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// UnmarshalValue stores a value returned by UnmarshalOrdered in the value v
+// points to, as Unmarshal does.
+func UnmarshalValue(value any, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("cannot decode into %T, need a non-nil pointer", v)
+	}
+	return assign(value, rv.Elem())
+}
+
+// field is an encoded struct field.
+type field struct {
+	key       string
+	index     int
+	omitEmpty bool
+}
+
+// structFieldCache maps struct types to their fields.
+var structFieldCache sync.Map
+
+// structFields returns the encoded fields of a struct type, sorted by key.
+// Unexported fields and fields tagged "-" are left out; embedded structs are
+// encoded as a field, not flattened.
+func structFields(t reflect.Type) []field {
+	if cached, ok := structFieldCache.Load(t); ok {
+		return cached.([]field)
+	}
+	var fields []field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("bencode")
+		if !sf.IsExported() || tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = sf.Name
+		}
+		fields = append(fields, field{key: name, index: i, omitEmpty: opts == "omitempty"})
+	}
+	sort.Slice(fields, func(i, j int) bool { return fields[i].key < fields[j].key })
+	structFieldCache.Store(t, fields)
+	return fields
+}
+
+// marshalReflect encodes values of types marshalValue doesn't handle directly.
+// Bools are encoded as the integers 0 and 1.
+func marshalReflect(v reflect.Value, b writer) error {
+	if !v.IsValid() {
+		return fmt.Errorf("cannot encode nil")
+	}
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return fmt.Errorf("cannot encode nil %s", v.Type())
+		}
+		return marshalValue(v.Elem().Interface(), b)
+	case reflect.Bool:
+		if v.Bool() {
+			marshalInt(1, b)
+		} else {
+			marshalInt(0, b)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		marshalInt(v.Int(), b)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if v.Uint() > math.MaxInt64 {
+			return fmt.Errorf("integer %d overflows int64", v.Uint())
+		}
+		marshalInt(int64(v.Uint()), b)
+	case reflect.String:
+		marshalString(v.String(), b)
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			s := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(s), v)
+			marshalBytes(s, b)
+			return nil
+		}
+		b.WriteRune('l')
+		for i := 0; i < v.Len(); i++ {
+			if err := marshalValue(v.Index(i).Interface(), b); err != nil {
+				return err
+			}
+		}
+		b.WriteRune('e')
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("unsupported map key type %s", v.Type().Key())
+		}
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+		b.WriteRune('d')
+		for _, key := range keys {
+			marshalString(key.String(), b)
+			if err := marshalValue(v.MapIndex(key).Interface(), b); err != nil {
+				return err
+			}
+		}
+		b.WriteRune('e')
+	case reflect.Struct:
+		b.WriteRune('d')
+		for _, f := range structFields(v.Type()) {
+			fv := v.Field(f.index)
+			if omitField(fv, f.omitEmpty) {
+				continue
+			}
+			marshalString(f.key, b)
+			if err := marshalValue(fv.Interface(), b); err != nil {
+				return fmt.Errorf("%s: %w", f.key, err)
+			}
+		}
+		b.WriteRune('e')
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// omitField reports whether a struct field is left out of its dictionary.
+// Bencode has no null, so nil pointers and interfaces always are.
+func omitField(v reflect.Value, omitEmpty bool) bool {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return true
+		}
+	case reflect.Slice, reflect.Map:
+		if omitEmpty && v.Len() == 0 {
+			return true
+		}
+	}
+	return omitEmpty && v.IsZero()
+}
+
+var dictType = reflect.TypeOf(Dict(nil))
+
+// assign stores the decoded value src in dst.
+func assign(src any, dst reflect.Value) error {
+	if dst.Type() == dictType {
+		d, ok := entries(src)
+		if !ok {
+			return mismatch(src, dst)
+		}
+		dst.Set(reflect.ValueOf(d))
+		return nil
+	}
+
+	switch dst.Kind() {
+	case reflect.Pointer:
+		if dst.IsNil() {
+			dst.Set(reflect.New(dst.Type().Elem()))
+		}
+		return assign(src, dst.Elem())
+	case reflect.Interface:
+		if dst.NumMethod() != 0 {
+			return mismatch(src, dst)
+		}
+		dst.Set(reflect.ValueOf(unordered(src)))
+	case reflect.Bool:
+		n, ok := src.(int64)
+		if !ok {
+			return mismatch(src, dst)
+		}
+		dst.SetBool(n != 0)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, ok := src.(int64)
+		if !ok {
+			return mismatch(src, dst)
+		}
+		if dst.OverflowInt(n) {
+			return fmt.Errorf("integer %d overflows %s", n, dst.Type())
+		}
+		dst.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, ok := src.(int64)
+		if !ok {
+			return mismatch(src, dst)
+		}
+		if n < 0 || dst.OverflowUint(uint64(n)) {
+			return fmt.Errorf("integer %d overflows %s", n, dst.Type())
+		}
+		dst.SetUint(uint64(n))
+	case reflect.String:
+		s, ok := src.(string)
+		if !ok {
+			return mismatch(src, dst)
+		}
+		dst.SetString(s)
+	case reflect.Slice:
+		if s, ok := src.(string); ok && dst.Type().Elem().Kind() == reflect.Uint8 {
+			dst.Set(reflect.ValueOf([]byte(s)).Convert(dst.Type()))
+			return nil
+		}
+		list, ok := src.([]any)
+		if !ok {
+			return mismatch(src, dst)
+		}
+		slice := reflect.MakeSlice(dst.Type(), len(list), len(list))
+		for i, item := range list {
+			if err := assign(item, slice.Index(i)); err != nil {
+				return fmt.Errorf("%d: %w", i, err)
+			}
+		}
+		dst.Set(slice)
+	case reflect.Array:
+		if s, ok := src.(string); ok && dst.Type().Elem().Kind() == reflect.Uint8 {
+			if len(s) != dst.Len() {
+				return fmt.Errorf("cannot decode string of %d bytes into %s", len(s), dst.Type())
+			}
+			reflect.Copy(dst, reflect.ValueOf([]byte(s)))
+			return nil
+		}
+		list, ok := src.([]any)
+		if !ok {
+			return mismatch(src, dst)
+		}
+		if len(list) != dst.Len() {
+			return fmt.Errorf("cannot decode list of %d items into %s", len(list), dst.Type())
+		}
+		for i, item := range list {
+			if err := assign(item, dst.Index(i)); err != nil {
+				return fmt.Errorf("%d: %w", i, err)
+			}
+		}
+	case reflect.Map:
+		d, ok := entries(src)
+		if !ok || dst.Type().Key().Kind() != reflect.String {
+			return mismatch(src, dst)
+		}
+		m := reflect.MakeMapWithSize(dst.Type(), len(d))
+		for _, e := range d {
+			elem := reflect.New(dst.Type().Elem()).Elem()
+			if err := assign(e.Value, elem); err != nil {
+				return fmt.Errorf("%s: %w", e.Key, err)
+			}
+			m.SetMapIndex(reflect.ValueOf(e.Key).Convert(dst.Type().Key()), elem)
+		}
+		dst.Set(m)
+	case reflect.Struct:
+		d, ok := entries(src)
+		if !ok {
+			return mismatch(src, dst)
+		}
+		fields := make(map[string]int)
+		for _, f := range structFields(dst.Type()) {
+			fields[f.key] = f.index
+		}
+		for _, e := range d {
+			i, ok := fields[e.Key]
+			if !ok {
+				continue
+			}
+			if err := assign(e.Value, dst.Field(i)); err != nil {
+				return fmt.Errorf("%s: %w", e.Key, err)
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported type %s", dst.Type())
+	}
+	return nil
+}
+
+// entries returns a decoded dictionary as a Dict. Maps have no order, so
+// their entries are sorted by key.
+func entries(src any) (Dict, bool) {
+	switch d := src.(type) {
+	case Dict:
+		return d, true
+	case map[string]any:
+		keys := make([]string, 0, len(d))
+		for key := range d {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		dict := make(Dict, len(keys))
+		for i, key := range keys {
+			dict[i] = DictEntry{Key: key, Value: d[key]}
+		}
+		return dict, true
+	}
+	return nil, false
+}
+
+// unordered converts the Dicts in a decoded value to maps, for interface
+// targets.
+func unordered(src any) any {
+	switch v := src.(type) {
+	case Dict:
+		m := make(map[string]any, len(v))
+		for _, e := range v {
+			m[e.Key] = unordered(e.Value)
+		}
+		return m
+	case []any:
+		list := make([]any, len(v))
+		for i, item := range v {
+			list[i] = unordered(item)
+		}
+		return list
+	}
+	return src
+}
+
+// mismatch returns the error for a decoded value that doesn't fit dst.
+func mismatch(src any, dst reflect.Value) error {
+	kind := "value"
+	switch src.(type) {
+	case int64:
+		kind = "integer"
+	case string:
+		kind = "string"
+	case []any:
+		kind = "list"
+	case Dict, map[string]any:
+		kind = "dictionary"
+	}
+	return fmt.Errorf("cannot decode %s into %s", kind, dst.Type())
+}
@@ -0,0 +1,182 @@
+package bencode
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type taggedFile struct {
+	Length int64    `bencode:"length"`
+	Path   []string `bencode:"path"`
+	MD5    string   `bencode:"md5sum,omitempty"`
+}
+
+type taggedInfo struct {
+	Name        string       `bencode:"name"`
+	PieceLength int64        `bencode:"piece length"`
+	Pieces      []byte       `bencode:"pieces"`
+	Files       []taggedFile `bencode:"files,omitempty"`
+	Private     bool         `bencode:"private,omitempty"`
+	Hash        [4]byte      `bencode:"hash"`
+	Skipped     string       `bencode:"-"`
+	Untagged    int
+	unexported  int
+}
+
+func TestMarshalStruct(t *testing.T) {
+	info := taggedInfo{
+		Name:        "a",
+		PieceLength: 16384,
+		Pieces:      []byte("xy"),
+		Files:       []taggedFile{{Length: 1, Path: []string{"d", "f"}}},
+		Private:     true,
+		Hash:        [4]byte{'h', 'a', 's', 'h'},
+		Skipped:     "skipped",
+		Untagged:    7,
+		unexported:  8,
+	}
+	got, err := Marshal(info)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	// Keys are sorted, omitempty fields that are empty and "-" fields are left out.
+	want := "d8:Untaggedi7e5:filesld6:lengthi1e4:pathl1:d1:feee4:hash4:hash4:name1:a12:piece lengthi16384e6:pieces2:xy7:privatei1ee"
+	if string(got) != want {
+		t.Errorf("Marshal = %s, want %s", got, want)
+	}
+	if !Valid(got) {
+		t.Errorf("Marshal output %s isn't canonical", got)
+	}
+
+	got, err = Marshal(&taggedInfo{Name: "a"})
+	if err != nil {
+		t.Fatalf("Marshal of a pointer: %v", err)
+	}
+	if want := "d8:Untaggedi0e4:hash4:\x00\x00\x00\x004:name1:a12:piece lengthi0e6:pieces0:e"; string(got) != want {
+		t.Errorf("Marshal = %q, want %q", got, want)
+	}
+}
+
+func TestUnmarshalStruct(t *testing.T) {
+	data := "d8:Untaggedi7e5:filesld6:lengthi1e6:md5sum3:abc4:pathl1:d1:feee4:hash4:hash5:extrai1e4:name1:a12:piece lengthi16384e6:pieces2:xy7:privatei1e7:Skipped1:se"
+	var got taggedInfo
+	if err := Unmarshal([]byte(data), &got); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	want := taggedInfo{
+		Name:        "a",
+		PieceLength: 16384,
+		Pieces:      []byte("xy"),
+		Files:       []taggedFile{{Length: 1, Path: []string{"d", "f"}, MD5: "abc"}},
+		Private:     true,
+		Hash:        [4]byte{'h', 'a', 's', 'h'},
+		Untagged:    7,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Unmarshal = %+v, want %+v", got, want)
+	}
+}
+
+func TestStructRoundTrip(t *testing.T) {
+	in := taggedInfo{Name: "a", PieceLength: 1 << 33, Pieces: []byte{0, 1, 2}, Files: []taggedFile{{Length: 5 << 30, Path: []string{"f"}}}}
+	data, err := Marshal(in)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	var out taggedInfo
+	if err := Unmarshal(data, &out); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("round trip = %+v, want %+v", out, in)
+	}
+}
+
+func TestUnmarshalTargets(t *testing.T) {
+	var m map[string]int
+	if err := Unmarshal([]byte("d1:ai1e1:bi2ee"), &m); err != nil || m["a"] != 1 || m["b"] != 2 {
+		t.Errorf("Unmarshal into map = %v, %v", m, err)
+	}
+
+	var d Dict
+	if err := Unmarshal([]byte("d1:bi2e1:ai1ee"), &d); err != nil {
+		t.Fatalf("Unmarshal into Dict: %v", err)
+	}
+	if len(d) != 2 || d[0].Key != "b" || d[1].Key != "a" {
+		t.Errorf("Unmarshal into Dict = %v, want the original key order", d)
+	}
+
+	var v any
+	if err := Unmarshal([]byte("d1:ald1:bi1eeee"), &v); err != nil {
+		t.Fatalf("Unmarshal into interface: %v", err)
+	}
+	want := map[string]any{"a": []any{map[string]any{"b": int64(1)}}}
+	if !reflect.DeepEqual(v, want) {
+		t.Errorf("Unmarshal into interface = %#v, want %#v", v, want)
+	}
+
+	var p *taggedFile
+	if err := Unmarshal([]byte("d6:lengthi3ee"), &p); err != nil || p == nil || p.Length != 3 {
+		t.Errorf("Unmarshal into pointer = %+v, %v", p, err)
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		target  any
+		wantErr string
+	}{
+		{"nil pointer", "i1e", (*int)(nil), "need a non-nil pointer"},
+		{"not a pointer", "i1e", 0, "need a non-nil pointer"},
+		{"string into int", "1:a", new(int), "cannot decode string into int"},
+		{"list into struct", "le", new(taggedFile), "cannot decode list into bencode.taggedFile"},
+		{"dict into slice", "de", new([]string), "cannot decode dictionary into []string"},
+		{"integer into string", "i1e", new(string), "cannot decode integer into string"},
+		{"field mismatch", "d6:length1:ae", new(taggedFile), "length: cannot decode string into int64"},
+		{"nested mismatch", "d4:pathli1eee", new(taggedFile), "path: 0: cannot decode integer"},
+		{"int8 overflow", "i128e", new(int8), "overflows int8"},
+		{"negative uint", "i-1e", new(uint), "overflows uint"},
+		{"uint8 overflow", "i256e", new(uint8), "overflows uint8"},
+		{"byte array length", "3:abc", new([4]byte), "string of 3 bytes"},
+		{"array length", "li1ee", new([2]int), "list of 1 items"},
+		{"map key type", "d1:ai1ee", new(map[int]int), "cannot decode dictionary"},
+		{"non-empty interface", "i1e", new(error), "cannot decode integer"},
+		{"unsupported type", "i1e", new(float64), "unsupported type float64"},
+		{"invalid data", "i1", new(int), "EOF"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Unmarshal([]byte(tt.data), tt.target)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Unmarshal(%q, %T) = %v, want error containing %q", tt.data, tt.target, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMarshalErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		v       any
+		wantErr string
+	}{
+		{"nil", nil, "cannot encode nil"},
+		{"float", 1.5, "unsupported type float64"},
+		{"map key type", map[int]string{1: "a"}, "unsupported map key type int"},
+		{"uint overflow", uint64(1 << 63), "overflows int64"},
+		{"nested field", struct {
+			F []any `bencode:"f"`
+		}{[]any{1.5}}, "f: unsupported type float64"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Marshal(tt.v)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Marshal(%#v) = %v, want error containing %q", tt.v, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -7,14 +7,34 @@ import (
 	"strconv"
 )
 
-// Unmarshal takes a byte slice of Bencode data and returns the decoded value.
-func Unmarshal(data []byte) (any, error) {
+// Unmarshal decodes data into the value v points to, in the manner of
+// encoding/json. Dictionaries decode into structs, using the key given by a
+// field's bencode tag or else the field name, and into maps with string keys.
+// Lists decode into slices and arrays, integers into any integer type or a
+// bool, and strings into strings, byte slices and byte arrays of matching
+// length. Keys without a matching field are ignored.
+//
+// An interface target receives the value as int64, string, []any or
+// map[string]any, and a Dict target receives the dictionary in its original
+// key order.
+func Unmarshal(data []byte, v any) error {
+	value, err := UnmarshalOrdered(data)
+	if err != nil {
+		return err
+	}
+	return UnmarshalValue(value, v)
+}
+
+// UnmarshalOrdered decodes data into int64, string, []any and Dict values,
+// keeping the entries of dictionaries in the order they appear in data.
+func UnmarshalOrdered(data []byte) (any, error) {
 	reader := bytes.NewReader(data)
-	return unmarshalValue(reader)
+	return unmarshalValue(reader, true)
 }
 
 // unmarshalValue determines the type of the value and calls the appropriate unmarshal function.
-func unmarshalValue(r io.Reader) (any, error) {
+// When ordered is set, dictionaries are decoded into Dict rather than maps.
+func unmarshalValue(r io.Reader, ordered bool) (any, error) {
 	ch, err := readByte(r)
 	if err != nil {
 		return nil, err
@@ -24,8 +44,11 @@ func unmarshalValue(r io.Reader) (any, error) {
 	case 'i':
 		return unmarshalInt(r)
 	case 'l':
-		return unmarshalList(r)
+		return unmarshalList(r, ordered)
 	case 'd':
+		if ordered {
+			return unmarshalOrderedDict(r)
+		}
 		return unmarshalDict(r)
 	default:
 		// For anything else, it must be a string.
@@ -36,8 +59,9 @@ func unmarshalValue(r io.Reader) (any, error) {
 	}
 }
 
-// unmarshalInt reads an integer from the Bencode data.
-func unmarshalInt(r io.Reader) (int, error) {
+// unmarshalInt reads an integer from the Bencode data. Integers are 64 bits
+// wide on every platform, since file sizes routinely exceed 2 GiB.
+func unmarshalInt(r io.Reader) (int64, error) {
 	var buf bytes.Buffer
 	for {
 		ch, err := readByte(r)
@@ -50,7 +74,7 @@ func unmarshalInt(r io.Reader) (int, error) {
 		buf.WriteByte(ch)
 	}
 
-	value, err := strconv.Atoi(buf.String())
+	value, err := strconv.ParseInt(buf.String(), 10, 64)
 	if err != nil {
 		return 0, fmt.Errorf("invalid integer value: %v", err)
 	}
@@ -68,6 +92,13 @@ func unmarshalString(r io.Reader) (string, error) {
 	if err != nil {
 		return "", fmt.Errorf("invalid string length: %v", err)
 	}
+	if length < 0 {
+		return "", fmt.Errorf("negative string length: %d", length)
+	}
+	// Guard against lengths that could never be satisfied by the input.
+	if lr, ok := r.(interface{ Len() int }); ok && length > lr.Len() {
+		return "", fmt.Errorf("string length %d exceeds remaining input", length)
+	}
 
 	strData := make([]byte, length)
 	if _, err := io.ReadFull(r, strData); err != nil {
@@ -78,7 +109,7 @@ func unmarshalString(r io.Reader) (string, error) {
 }
 
 // unmarshalList reads a list from the Bencode data.
-func unmarshalList(r io.Reader) ([]any, error) {
+func unmarshalList(r io.Reader, ordered bool) ([]any, error) {
 	var list []any
 	for {
 		ch, err := readByte(r)
@@ -92,7 +123,7 @@ func unmarshalList(r io.Reader) ([]any, error) {
 		if err := unreadByte(r, ch); err != nil {
 			return nil, err
 		}
-		value, err := unmarshalValue(r)
+		value, err := unmarshalValue(r, ordered)
 		if err != nil {
 			return nil, err
 		}
@@ -120,7 +151,7 @@ func unmarshalDict(r io.Reader) (map[string]any, error) {
 		if err != nil {
 			return nil, err
 		}
-		value, err := unmarshalValue(r)
+		value, err := unmarshalValue(r, false)
 		if err != nil {
 			return nil, err
 		}
@@ -129,6 +160,34 @@ func unmarshalDict(r io.Reader) (map[string]any, error) {
 	return dict, nil
 }
 
+// unmarshalOrderedDict reads a dictionary from the Bencode data, keeping its key order.
+func unmarshalOrderedDict(r io.Reader) (Dict, error) {
+	dict := Dict{}
+	for {
+		ch, err := readByte(r)
+		if err != nil {
+			return nil, err
+		}
+		if ch == 'e' {
+			break
+		}
+		// Rewind the byte to read it correctly
+		if err := unreadByte(r, ch); err != nil {
+			return nil, err
+		}
+		key, err := unmarshalString(r)
+		if err != nil {
+			return nil, err
+		}
+		value, err := unmarshalValue(r, true)
+		if err != nil {
+			return nil, err
+		}
+		dict = append(dict, DictEntry{Key: key, Value: value})
+	}
+	return dict, nil
+}
+
 // Helper functions
 
 // readByte reads a single byte from the reader.
@@ -0,0 +1,56 @@
+package bencode
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestUnmarshalLargeIntegers(t *testing.T) {
+	tests := []int64{
+		0,
+		-1,
+		math.MaxInt32 + 1,
+		1 << 32,
+		1<<32 + 1,
+		5 << 30,
+		-(5 << 30),
+		math.MaxInt64,
+		math.MinInt64,
+	}
+	for _, want := range tests {
+		data := "i" + strconv.FormatInt(want, 10) + "e"
+		var got any
+		if err := Unmarshal([]byte(data), &got); err != nil {
+			t.Errorf("Unmarshal(%s): %v", data, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("Unmarshal(%s) = %v (%T), want %d", data, got, got, want)
+		}
+		encoded, err := Marshal(want)
+		if err != nil || string(encoded) != data {
+			t.Errorf("Marshal(%d) = %q, %v, want %q", want, encoded, err, data)
+		}
+	}
+}
+
+func TestUnmarshalIntegerOverflow(t *testing.T) {
+	for _, data := range []string{"i9223372036854775808e", "i-9223372036854775809e", "i99999999999999999999e"} {
+		var v any
+		if err := Unmarshal([]byte(data), &v); err == nil {
+			t.Errorf("Unmarshal(%s) = %v, want error", data, v)
+		}
+	}
+}
+
+func TestUnmarshalLargeLengthInDict(t *testing.T) {
+	data := "d6:lengthi5368709120e4:name1:ae"
+	var v any
+	if err := Unmarshal([]byte(data), &v); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if got := v.(map[string]any)["length"]; got != int64(5<<30) {
+		t.Errorf("length = %v, want %d", got, int64(5<<30))
+	}
+}
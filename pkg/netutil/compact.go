@@ -0,0 +1,93 @@
+package netutil
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+)
+
+// Sizes of the compact encodings.
+const (
+	CompactPeerLen  = 6  // IPv4 address and port
+	CompactPeer6Len = 18 // IPv6 address and port
+	NodeContactLen  = 20 + CompactPeerLen
+	NodeContact6Len = 20 + CompactPeer6Len
+)
+
+// NodeContact is a DHT node ID with the node's address.
+type NodeContact struct {
+	ID   [20]byte
+	Addr netip.AddrPort
+}
+
+// DecodeCompactPeers decodes a string of 6-byte IPv4 peers, as used by trackers and PEX.
+func DecodeCompactPeers(b []byte) ([]netip.AddrPort, error) {
+	return decodeCompactPeers(b, CompactPeerLen)
+}
+
+// DecodeCompactPeers6 decodes a string of 18-byte IPv6 peers (BEP 7).
+func DecodeCompactPeers6(b []byte) ([]netip.AddrPort, error) {
+	return decodeCompactPeers(b, CompactPeer6Len)
+}
+
+func decodeCompactPeers(b []byte, size int) ([]netip.AddrPort, error) {
+	if len(b)%size != 0 {
+		return nil, fmt.Errorf("compact peers length %d is not a multiple of %d", len(b), size)
+	}
+	peers := make([]netip.AddrPort, 0, len(b)/size)
+	for i := 0; i < len(b); i += size {
+		peers = append(peers, decodeAddrPort(b[i:i+size]))
+	}
+	return peers, nil
+}
+
+// AppendCompactPeer appends the compact form of peer to b: 6 bytes for an
+// IPv4 address (including IPv4-mapped IPv6 addresses) and 18 bytes otherwise.
+func AppendCompactPeer(b []byte, peer netip.AddrPort) []byte {
+	addr := peer.Addr().Unmap()
+	if addr.Is4() {
+		a := addr.As4()
+		b = append(b, a[:]...)
+	} else {
+		a := addr.As16()
+		b = append(b, a[:]...)
+	}
+	return binary.BigEndian.AppendUint16(b, peer.Port())
+}
+
+// DecodeNodes decodes a string of 26-byte IPv4 DHT node contacts (BEP 5).
+func DecodeNodes(b []byte) ([]NodeContact, error) {
+	return decodeNodes(b, NodeContactLen)
+}
+
+// DecodeNodes6 decodes a string of 38-byte IPv6 DHT node contacts (BEP 32).
+func DecodeNodes6(b []byte) ([]NodeContact, error) {
+	return decodeNodes(b, NodeContact6Len)
+}
+
+func decodeNodes(b []byte, size int) ([]NodeContact, error) {
+	if len(b)%size != 0 {
+		return nil, fmt.Errorf("compact nodes length %d is not a multiple of %d", len(b), size)
+	}
+	nodes := make([]NodeContact, 0, len(b)/size)
+	for i := 0; i < len(b); i += size {
+		var n NodeContact
+		copy(n.ID[:], b[i:i+20])
+		n.Addr = decodeAddrPort(b[i+20 : i+size])
+		nodes = append(nodes, n)
+	}
+	return nodes, nil
+}
+
+// AppendNodeContact appends the compact form of a DHT node contact to b.
+func AppendNodeContact(b []byte, n NodeContact) []byte {
+	b = append(b, n.ID[:]...)
+	return AppendCompactPeer(b, n.Addr)
+}
+
+// decodeAddrPort decodes a 6 or 18 byte compact address and port.
+func decodeAddrPort(b []byte) netip.AddrPort {
+	ipLen := len(b) - 2
+	addr, _ := netip.AddrFromSlice(b[:ipLen])
+	return netip.AddrPortFrom(addr, binary.BigEndian.Uint16(b[ipLen:]))
+}
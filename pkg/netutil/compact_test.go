@@ -0,0 +1,99 @@
+package netutil
+
+import (
+	"bytes"
+	"net/netip"
+	"slices"
+	"testing"
+)
+
+func TestCompactPeersRoundTrip(t *testing.T) {
+	peers4 := []netip.AddrPort{
+		netip.MustParseAddrPort("10.0.0.1:6881"),
+		netip.MustParseAddrPort("192.168.1.2:80"),
+		netip.MustParseAddrPort("255.255.255.255:65535"),
+	}
+	var b []byte
+	for _, p := range peers4 {
+		b = AppendCompactPeer(b, p)
+	}
+	want := []byte{10, 0, 0, 1, 0x1a, 0xe1, 192, 168, 1, 2, 0, 80, 255, 255, 255, 255, 0xff, 0xff}
+	if !bytes.Equal(b, want) {
+		t.Errorf("AppendCompactPeer = %v, want %v", b, want)
+	}
+	got, err := DecodeCompactPeers(b)
+	if err != nil || !slices.Equal(got, peers4) {
+		t.Errorf("DecodeCompactPeers = %v, %v, want %v", got, err, peers4)
+	}
+
+	peers6 := []netip.AddrPort{
+		netip.MustParseAddrPort("[2001:db8::1]:6881"),
+		netip.MustParseAddrPort("[::1]:1"),
+	}
+	b = nil
+	for _, p := range peers6 {
+		b = AppendCompactPeer(b, p)
+	}
+	if len(b) != 2*CompactPeer6Len {
+		t.Fatalf("AppendCompactPeer wrote %d bytes for two IPv6 peers, want %d", len(b), 2*CompactPeer6Len)
+	}
+	got, err = DecodeCompactPeers6(b)
+	if err != nil || !slices.Equal(got, peers6) {
+		t.Errorf("DecodeCompactPeers6 = %v, %v, want %v", got, err, peers6)
+	}
+}
+
+func TestAppendCompactPeerMapped(t *testing.T) {
+	b := AppendCompactPeer(nil, netip.MustParseAddrPort("[::ffff:10.0.0.1]:6881"))
+	if want := []byte{10, 0, 0, 1, 0x1a, 0xe1}; !bytes.Equal(b, want) {
+		t.Errorf("AppendCompactPeer of an IPv4-mapped address = %v, want %v", b, want)
+	}
+}
+
+func TestNodesRoundTrip(t *testing.T) {
+	nodes := []NodeContact{
+		{ID: [20]byte{1, 2, 3}, Addr: netip.MustParseAddrPort("10.0.0.1:6881")},
+		{ID: [20]byte{19: 0xff}, Addr: netip.MustParseAddrPort("192.0.2.7:1")},
+	}
+	var b []byte
+	for _, n := range nodes {
+		b = AppendNodeContact(b, n)
+	}
+	if len(b) != 2*NodeContactLen {
+		t.Fatalf("AppendNodeContact wrote %d bytes, want %d", len(b), 2*NodeContactLen)
+	}
+	got, err := DecodeNodes(b)
+	if err != nil || !slices.Equal(got, nodes) {
+		t.Errorf("DecodeNodes = %v, %v, want %v", got, err, nodes)
+	}
+
+	nodes6 := []NodeContact{{ID: [20]byte{9}, Addr: netip.MustParseAddrPort("[2001:db8::2]:51413")}}
+	b = AppendNodeContact(nil, nodes6[0])
+	got, err = DecodeNodes6(b)
+	if err != nil || !slices.Equal(got, nodes6) {
+		t.Errorf("DecodeNodes6 = %v, %v, want %v", got, err, nodes6)
+	}
+}
+
+func TestCompactBadLength(t *testing.T) {
+	tests := []struct {
+		name   string
+		decode func([]byte) error
+		size   int
+	}{
+		{"DecodeCompactPeers", func(b []byte) error { _, err := DecodeCompactPeers(b); return err }, CompactPeerLen},
+		{"DecodeCompactPeers6", func(b []byte) error { _, err := DecodeCompactPeers6(b); return err }, CompactPeer6Len},
+		{"DecodeNodes", func(b []byte) error { _, err := DecodeNodes(b); return err }, NodeContactLen},
+		{"DecodeNodes6", func(b []byte) error { _, err := DecodeNodes6(b); return err }, NodeContact6Len},
+	}
+	for _, tt := range tests {
+		if err := tt.decode(nil); err != nil {
+			t.Errorf("%s(empty) = %v, want no error", tt.name, err)
+		}
+		for _, n := range []int{1, tt.size - 1, tt.size + 1, 2*tt.size - 1} {
+			if err := tt.decode(make([]byte, n)); err == nil {
+				t.Errorf("%s(%d bytes) succeeded, want a length error", tt.name, n)
+			}
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package peerwire
+
+import (
+	"fmt"
+	"io"
+)
+
+// Protocol is the protocol string sent at the start of every handshake.
+const Protocol = "BitTorrent protocol"
+
+// handshakeLength is the size of a handshake with the standard protocol string.
+const handshakeLength = 1 + len(Protocol) + 8 + 20 + 20
+
+// ReservedBit is a flag in the reserved bytes of a handshake advertising a protocol extension.
+type ReservedBit struct {
+	Byte int
+	Mask byte
+}
+
+// Reserved bits of the extensions this package has messages for.
+var (
+	ExtensionProtocolBit = ReservedBit{Byte: 5, Mask: 0x10} // BEP 10
+	FastBit              = ReservedBit{Byte: 7, Mask: 0x04} // BEP 6
+	DHTBit               = ReservedBit{Byte: 7, Mask: 0x01} // BEP 5
+)
+
+// Handshake is the first message exchanged on a peer connection.
+type Handshake struct {
+	Reserved [8]byte
+	InfoHash [20]byte
+	PeerID   [20]byte
+}
+
+// Has reports whether bit is set in the reserved bytes.
+func (h Handshake) Has(bit ReservedBit) bool {
+	return h.Reserved[bit.Byte]&bit.Mask != 0
+}
+
+// Set sets bit in the reserved bytes.
+func (h *Handshake) Set(bit ReservedBit) {
+	h.Reserved[bit.Byte] |= bit.Mask
+}
+
+// WriteHandshake writes h to w.
+func WriteHandshake(w io.Writer, h Handshake) error {
+	buf := make([]byte, 0, handshakeLength)
+	buf = append(buf, byte(len(Protocol)))
+	buf = append(buf, Protocol...)
+	buf = append(buf, h.Reserved[:]...)
+	buf = append(buf, h.InfoHash[:]...)
+	buf = append(buf, h.PeerID[:]...)
+	_, err := w.Write(buf)
+	return err
+}
+
+// ReadHandshake reads a handshake from r, rejecting any protocol other than BitTorrent.
+func ReadHandshake(r io.Reader) (Handshake, error) {
+	var h Handshake
+	buf := make([]byte, handshakeLength)
+	if _, err := io.ReadFull(r, buf[:1]); err != nil {
+		return h, err
+	}
+	if int(buf[0]) != len(Protocol) {
+		return h, fmt.Errorf("unexpected protocol string length %d", buf[0])
+	}
+	if _, err := io.ReadFull(r, buf[1:]); err != nil {
+		return h, unexpectedEOF(err)
+	}
+	if string(buf[1:1+len(Protocol)]) != Protocol {
+		return h, fmt.Errorf("unexpected protocol %q", buf[1:1+len(Protocol)])
+	}
+
+	rest := buf[1+len(Protocol):]
+	copy(h.Reserved[:], rest[0:8])
+	copy(h.InfoHash[:], rest[8:28])
+	copy(h.PeerID[:], rest[28:48])
+	return h, nil
+}
@@ -0,0 +1,79 @@
+package peerwire
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestHandshakeRoundTrip(t *testing.T) {
+	var h Handshake
+	copy(h.InfoHash[:], "infohashinfohashinfo")
+	copy(h.PeerID[:], "-BT0001-abcdefghijkl")
+	h.Set(FastBit)
+	h.Set(ExtensionProtocolBit)
+
+	var buf bytes.Buffer
+	if err := WriteHandshake(&buf, h); err != nil {
+		t.Fatalf("WriteHandshake: %v", err)
+	}
+	wire := buf.Bytes()
+	if len(wire) != 68 || wire[0] != 19 || string(wire[1:20]) != Protocol {
+		t.Fatalf("WriteHandshake wrote %q", wire)
+	}
+	if wire[20+5] != 0x10 || wire[20+7] != 0x04 {
+		t.Errorf("reserved bytes are %x", wire[20:28])
+	}
+
+	got, err := ReadHandshake(&buf)
+	if err != nil {
+		t.Fatalf("ReadHandshake: %v", err)
+	}
+	if got != h {
+		t.Errorf("ReadHandshake = %+v, want %+v", got, h)
+	}
+}
+
+func TestHandshakeReservedBits(t *testing.T) {
+	bits := []ReservedBit{ExtensionProtocolBit, FastBit, DHTBit}
+	for i, bit := range bits {
+		var h Handshake
+		h.Set(bit)
+		for j, other := range bits {
+			if h.Has(other) != (i == j) {
+				t.Errorf("with only bit %d set, Has(bit %d) = %t", i, j, h.Has(other))
+			}
+		}
+	}
+
+	// Bits set by other extensions don't affect the ones we know.
+	h := Handshake{Reserved: [8]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xef, 0xff, 0xfa}}
+	if h.Has(ExtensionProtocolBit) || h.Has(FastBit) || h.Has(DHTBit) {
+		t.Errorf("Has reports bits that aren't set in %x", h.Reserved)
+	}
+}
+
+func TestReadHandshakeMalformed(t *testing.T) {
+	var buf bytes.Buffer
+	WriteHandshake(&buf, Handshake{})
+	valid := buf.Bytes()
+
+	wrongLength := append([]byte{18}, valid[1:]...)
+	if _, err := ReadHandshake(bytes.NewReader(wrongLength)); err == nil {
+		t.Error("ReadHandshake accepted a protocol string of the wrong length")
+	}
+
+	wrongProtocol := bytes.Clone(valid)
+	copy(wrongProtocol[1:], "BitTorrent protocoX")
+	if _, err := ReadHandshake(bytes.NewReader(wrongProtocol)); err == nil {
+		t.Error("ReadHandshake accepted another protocol")
+	}
+
+	for i := 1; i < len(valid); i++ {
+		_, err := ReadHandshake(bytes.NewReader(valid[:i]))
+		if !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("ReadHandshake of %d bytes = %v, want io.ErrUnexpectedEOF", i, err)
+		}
+	}
+}
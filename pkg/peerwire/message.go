@@ -0,0 +1,339 @@
+package peerwire
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// MessageID identifies the type of a peer wire message.
+type MessageID uint8
+
+// Message IDs from BEP 3, the fast extension (BEP 6) and the extension protocol (BEP 10).
+const (
+	MsgChoke         MessageID = 0
+	MsgUnchoke       MessageID = 1
+	MsgInterested    MessageID = 2
+	MsgNotInterested MessageID = 3
+	MsgHave          MessageID = 4
+	MsgBitfield      MessageID = 5
+	MsgRequest       MessageID = 6
+	MsgPiece         MessageID = 7
+	MsgCancel        MessageID = 8
+	MsgPort          MessageID = 9
+	MsgSuggest       MessageID = 13
+	MsgHaveAll       MessageID = 14
+	MsgHaveNone      MessageID = 15
+	MsgReject        MessageID = 16
+	MsgAllowedFast   MessageID = 17
+	MsgExtended      MessageID = 20
+)
+
+var messageNames = map[MessageID]string{
+	MsgChoke:         "choke",
+	MsgUnchoke:       "unchoke",
+	MsgInterested:    "interested",
+	MsgNotInterested: "not interested",
+	MsgHave:          "have",
+	MsgBitfield:      "bitfield",
+	MsgRequest:       "request",
+	MsgPiece:         "piece",
+	MsgCancel:        "cancel",
+	MsgPort:          "port",
+	MsgSuggest:       "suggest",
+	MsgHaveAll:       "have all",
+	MsgHaveNone:      "have none",
+	MsgReject:        "reject",
+	MsgAllowedFast:   "allowed fast",
+	MsgExtended:      "extended",
+}
+
+func (id MessageID) String() string {
+	if name, ok := messageNames[id]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown(%d)", uint8(id))
+}
+
+// MaxMessageLength is the largest message ReadMessage accepts. It leaves room
+// for a 16 KiB block and for the bitfield of a torrent with millions of pieces.
+const MaxMessageLength = 1 << 20
+
+// ErrMessageTooLong is returned when a message's length prefix exceeds the allowed maximum.
+var ErrMessageTooLong = errors.New("message too long")
+
+// Message is a peer wire message other than keep-alive.
+type Message interface {
+	ID() MessageID
+	// appendPayload appends the message payload, without length prefix or ID, to b.
+	appendPayload(b []byte) []byte
+}
+
+// Choke tells the peer we won't serve its requests.
+type Choke struct{}
+
+// Unchoke tells the peer we will serve its requests.
+type Unchoke struct{}
+
+// Interested tells the peer we want pieces it has.
+type Interested struct{}
+
+// NotInterested tells the peer we don't want any pieces it has.
+type NotInterested struct{}
+
+// Have announces that the sender has verified a piece.
+type Have struct {
+	Index uint32
+}
+
+// Bitfield announces every piece the sender has, most significant bit first.
+type Bitfield struct {
+	Bits []byte
+}
+
+// Request asks for a block of a piece.
+type Request struct {
+	Index, Begin, Length uint32
+}
+
+// Piece carries a block of a piece.
+type Piece struct {
+	Index, Begin uint32
+	Block        []byte
+}
+
+// Cancel withdraws an earlier Request.
+type Cancel struct {
+	Index, Begin, Length uint32
+}
+
+// Port announces the sender's DHT port.
+type Port struct {
+	Port uint16
+}
+
+// Suggest recommends a piece to download (BEP 6).
+type Suggest struct {
+	Index uint32
+}
+
+// HaveAll announces that the sender has every piece (BEP 6).
+type HaveAll struct{}
+
+// HaveNone announces that the sender has no pieces (BEP 6).
+type HaveNone struct{}
+
+// Reject refuses a Request (BEP 6).
+type Reject struct {
+	Index, Begin, Length uint32
+}
+
+// AllowedFast lets the peer request a piece while choked (BEP 6).
+type AllowedFast struct {
+	Index uint32
+}
+
+// Extended is an extension protocol message (BEP 10). ExtendedID 0 is the extension handshake.
+type Extended struct {
+	ExtendedID uint8
+	Payload    []byte
+}
+
+// Unknown is a message with an ID this package doesn't know.
+type Unknown struct {
+	MessageID MessageID
+	Payload   []byte
+}
+
+func (Choke) ID() MessageID         { return MsgChoke }
+func (Unchoke) ID() MessageID       { return MsgUnchoke }
+func (Interested) ID() MessageID    { return MsgInterested }
+func (NotInterested) ID() MessageID { return MsgNotInterested }
+func (Have) ID() MessageID          { return MsgHave }
+func (Bitfield) ID() MessageID      { return MsgBitfield }
+func (Request) ID() MessageID       { return MsgRequest }
+func (Piece) ID() MessageID         { return MsgPiece }
+func (Cancel) ID() MessageID        { return MsgCancel }
+func (Port) ID() MessageID          { return MsgPort }
+func (Suggest) ID() MessageID       { return MsgSuggest }
+func (HaveAll) ID() MessageID       { return MsgHaveAll }
+func (HaveNone) ID() MessageID      { return MsgHaveNone }
+func (Reject) ID() MessageID        { return MsgReject }
+func (AllowedFast) ID() MessageID   { return MsgAllowedFast }
+func (Extended) ID() MessageID      { return MsgExtended }
+func (m Unknown) ID() MessageID     { return m.MessageID }
+
+func (Choke) appendPayload(b []byte) []byte         { return b }
+func (Unchoke) appendPayload(b []byte) []byte       { return b }
+func (Interested) appendPayload(b []byte) []byte    { return b }
+func (NotInterested) appendPayload(b []byte) []byte { return b }
+func (HaveAll) appendPayload(b []byte) []byte       { return b }
+func (HaveNone) appendPayload(b []byte) []byte      { return b }
+
+func (m Have) appendPayload(b []byte) []byte        { return binary.BigEndian.AppendUint32(b, m.Index) }
+func (m Suggest) appendPayload(b []byte) []byte     { return binary.BigEndian.AppendUint32(b, m.Index) }
+func (m AllowedFast) appendPayload(b []byte) []byte { return binary.BigEndian.AppendUint32(b, m.Index) }
+func (m Bitfield) appendPayload(b []byte) []byte    { return append(b, m.Bits...) }
+func (m Port) appendPayload(b []byte) []byte        { return binary.BigEndian.AppendUint16(b, m.Port) }
+func (m Unknown) appendPayload(b []byte) []byte     { return append(b, m.Payload...) }
+
+func (m Request) appendPayload(b []byte) []byte {
+	return appendBlockRef(b, m.Index, m.Begin, m.Length)
+}
+
+func (m Cancel) appendPayload(b []byte) []byte {
+	return appendBlockRef(b, m.Index, m.Begin, m.Length)
+}
+
+func (m Reject) appendPayload(b []byte) []byte {
+	return appendBlockRef(b, m.Index, m.Begin, m.Length)
+}
+
+func (m Piece) appendPayload(b []byte) []byte {
+	b = binary.BigEndian.AppendUint32(b, m.Index)
+	b = binary.BigEndian.AppendUint32(b, m.Begin)
+	return append(b, m.Block...)
+}
+
+func (m Extended) appendPayload(b []byte) []byte {
+	b = append(b, m.ExtendedID)
+	return append(b, m.Payload...)
+}
+
+// appendBlockRef appends the index, begin and length fields shared by request, cancel and reject.
+func appendBlockRef(b []byte, index, begin, length uint32) []byte {
+	b = binary.BigEndian.AppendUint32(b, index)
+	b = binary.BigEndian.AppendUint32(b, begin)
+	return binary.BigEndian.AppendUint32(b, length)
+}
+
+// WriteMessage writes m to w with its length prefix.
+func WriteMessage(w io.Writer, m Message) error {
+	buf := make([]byte, 5, 5+16)
+	buf[4] = byte(m.ID())
+	buf = m.appendPayload(buf)
+	binary.BigEndian.PutUint32(buf[:4], uint32(len(buf)-4))
+	_, err := w.Write(buf)
+	return err
+}
+
+// WriteKeepAlive writes a keep-alive, a message of length zero, to w.
+func WriteKeepAlive(w io.Writer) error {
+	_, err := w.Write([]byte{0, 0, 0, 0})
+	return err
+}
+
+// ReadMessage reads the next message from r. A keep-alive is returned as a nil Message.
+// Messages longer than MaxMessageLength are rejected without reading their payload.
+func ReadMessage(r io.Reader) (Message, error) {
+	var lengthBuf [4]byte
+	if _, err := io.ReadFull(r, lengthBuf[:]); err != nil {
+		return nil, err
+	}
+	length := binary.BigEndian.Uint32(lengthBuf[:])
+	if length == 0 {
+		return nil, nil
+	}
+	if length > MaxMessageLength {
+		return nil, fmt.Errorf("%w: %d bytes", ErrMessageTooLong, length)
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	return ParseMessage(MessageID(body[0]), body[1:])
+}
+
+// ParseMessage decodes the payload of a message with the given ID.
+func ParseMessage(id MessageID, payload []byte) (Message, error) {
+	switch id {
+	case MsgChoke, MsgUnchoke, MsgInterested, MsgNotInterested, MsgHaveAll, MsgHaveNone:
+		if len(payload) != 0 {
+			return nil, fmt.Errorf("%s message has a %d byte payload, expected none", id, len(payload))
+		}
+		switch id {
+		case MsgChoke:
+			return Choke{}, nil
+		case MsgUnchoke:
+			return Unchoke{}, nil
+		case MsgInterested:
+			return Interested{}, nil
+		case MsgNotInterested:
+			return NotInterested{}, nil
+		case MsgHaveAll:
+			return HaveAll{}, nil
+		default:
+			return HaveNone{}, nil
+		}
+	case MsgHave, MsgSuggest, MsgAllowedFast:
+		if err := checkPayloadLength(id, payload, 4); err != nil {
+			return nil, err
+		}
+		index := binary.BigEndian.Uint32(payload)
+		switch id {
+		case MsgHave:
+			return Have{Index: index}, nil
+		case MsgSuggest:
+			return Suggest{Index: index}, nil
+		default:
+			return AllowedFast{Index: index}, nil
+		}
+	case MsgRequest, MsgCancel, MsgReject:
+		if err := checkPayloadLength(id, payload, 12); err != nil {
+			return nil, err
+		}
+		index := binary.BigEndian.Uint32(payload[0:4])
+		begin := binary.BigEndian.Uint32(payload[4:8])
+		length := binary.BigEndian.Uint32(payload[8:12])
+		switch id {
+		case MsgRequest:
+			return Request{Index: index, Begin: begin, Length: length}, nil
+		case MsgCancel:
+			return Cancel{Index: index, Begin: begin, Length: length}, nil
+		default:
+			return Reject{Index: index, Begin: begin, Length: length}, nil
+		}
+	case MsgBitfield:
+		return Bitfield{Bits: payload}, nil
+	case MsgPiece:
+		if len(payload) < 8 {
+			return nil, fmt.Errorf("piece message has a %d byte payload, expected at least 8", len(payload))
+		}
+		return Piece{
+			Index: binary.BigEndian.Uint32(payload[0:4]),
+			Begin: binary.BigEndian.Uint32(payload[4:8]),
+			Block: payload[8:],
+		}, nil
+	case MsgPort:
+		if err := checkPayloadLength(id, payload, 2); err != nil {
+			return nil, err
+		}
+		return Port{Port: binary.BigEndian.Uint16(payload)}, nil
+	case MsgExtended:
+		if len(payload) < 1 {
+			return nil, fmt.Errorf("extended message has an empty payload")
+		}
+		return Extended{ExtendedID: payload[0], Payload: payload[1:]}, nil
+	default:
+		return Unknown{MessageID: id, Payload: payload}, nil
+	}
+}
+
+// unexpectedEOF turns io.EOF into io.ErrUnexpectedEOF, for reads that
+// continue a message or handshake that has already started.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// checkPayloadLength reports an error unless payload is exactly want bytes long.
+func checkPayloadLength(id MessageID, payload []byte, want int) error {
+	if len(payload) != want {
+		return fmt.Errorf("%s message has a %d byte payload, expected %d", id, len(payload), want)
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package peerwire
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMessageRoundTrip(t *testing.T) {
+	tests := []struct {
+		msg  Message
+		wire []byte
+	}{
+		{Choke{}, []byte{0, 0, 0, 1, 0}},
+		{Unchoke{}, []byte{0, 0, 0, 1, 1}},
+		{Interested{}, []byte{0, 0, 0, 1, 2}},
+		{NotInterested{}, []byte{0, 0, 0, 1, 3}},
+		{Have{Index: 0x01020304}, []byte{0, 0, 0, 5, 4, 1, 2, 3, 4}},
+		{Bitfield{Bits: []byte{0xa5, 0x80}}, []byte{0, 0, 0, 3, 5, 0xa5, 0x80}},
+		{Request{Index: 1, Begin: 0x4000, Length: 0x4000}, []byte{0, 0, 0, 13, 6, 0, 0, 0, 1, 0, 0, 0x40, 0, 0, 0, 0x40, 0}},
+		{Piece{Index: 2, Begin: 3, Block: []byte("data")}, []byte{0, 0, 0, 13, 7, 0, 0, 0, 2, 0, 0, 0, 3, 'd', 'a', 't', 'a'}},
+		{Cancel{Index: 1, Begin: 2, Length: 3}, []byte{0, 0, 0, 13, 8, 0, 0, 0, 1, 0, 0, 0, 2, 0, 0, 0, 3}},
+		{Port{Port: 6881}, []byte{0, 0, 0, 3, 9, 0x1a, 0xe1}},
+		{Suggest{Index: 7}, []byte{0, 0, 0, 5, 13, 0, 0, 0, 7}},
+		{HaveAll{}, []byte{0, 0, 0, 1, 14}},
+		{HaveNone{}, []byte{0, 0, 0, 1, 15}},
+		{Reject{Index: 4, Begin: 5, Length: 6}, []byte{0, 0, 0, 13, 16, 0, 0, 0, 4, 0, 0, 0, 5, 0, 0, 0, 6}},
+		{AllowedFast{Index: 9}, []byte{0, 0, 0, 5, 17, 0, 0, 0, 9}},
+		{Extended{ExtendedID: 0, Payload: []byte("de")}, []byte{0, 0, 0, 4, 20, 0, 'd', 'e'}},
+		{Unknown{MessageID: 99, Payload: []byte{1, 2}}, []byte{0, 0, 0, 3, 99, 1, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.msg.ID().String(), func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := WriteMessage(&buf, tt.msg); err != nil {
+				t.Fatalf("WriteMessage: %v", err)
+			}
+			if !bytes.Equal(buf.Bytes(), tt.wire) {
+				t.Errorf("WriteMessage wrote %v, want %v", buf.Bytes(), tt.wire)
+			}
+			got, err := ReadMessage(&buf)
+			if err != nil {
+				t.Fatalf("ReadMessage: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.msg) {
+				t.Errorf("ReadMessage = %#v, want %#v", got, tt.msg)
+			}
+			if buf.Len() != 0 {
+				t.Errorf("%d bytes left unread", buf.Len())
+			}
+		})
+	}
+}
+
+func TestEmptyPayloadsRoundTrip(t *testing.T) {
+	for _, msg := range []Message{Bitfield{}, Piece{Index: 1, Begin: 2}, Extended{ExtendedID: 3}} {
+		var buf bytes.Buffer
+		if err := WriteMessage(&buf, msg); err != nil {
+			t.Fatalf("WriteMessage(%v): %v", msg.ID(), err)
+		}
+		got, err := ReadMessage(&buf)
+		if err != nil {
+			t.Fatalf("ReadMessage(%v): %v", msg.ID(), err)
+		}
+		if got.ID() != msg.ID() {
+			t.Errorf("ReadMessage = %v, want %v", got.ID(), msg.ID())
+		}
+	}
+}
+
+func TestKeepAlive(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteKeepAlive(&buf); err != nil {
+		t.Fatalf("WriteKeepAlive: %v", err)
+	}
+	msg, err := ReadMessage(&buf)
+	if err != nil || msg != nil {
+		t.Errorf("ReadMessage = %v, %v, want nil, nil", msg, err)
+	}
+}
+
+func TestParseMessageMalformed(t *testing.T) {
+	tests := []struct {
+		id      MessageID
+		payload []byte
+	}{
+		{MsgChoke, []byte{0}},
+		{MsgUnchoke, []byte{0}},
+		{MsgInterested, []byte{0, 0}},
+		{MsgNotInterested, []byte{0}},
+		{MsgHaveAll, []byte{0}},
+		{MsgHaveNone, []byte{0}},
+		{MsgHave, nil},
+		{MsgHave, []byte{0, 0, 0}},
+		{MsgHave, []byte{0, 0, 0, 0, 0}},
+		{MsgSuggest, []byte{0, 0}},
+		{MsgAllowedFast, []byte{0, 0, 0, 0, 0}},
+		{MsgRequest, make([]byte, 11)},
+		{MsgRequest, make([]byte, 13)},
+		{MsgCancel, make([]byte, 8)},
+		{MsgReject, make([]byte, 16)},
+		{MsgPiece, nil},
+		{MsgPiece, make([]byte, 7)},
+		{MsgPort, []byte{1}},
+		{MsgPort, []byte{1, 2, 3}},
+		{MsgExtended, nil},
+	}
+	for _, tt := range tests {
+		if msg, err := ParseMessage(tt.id, tt.payload); err == nil {
+			t.Errorf("ParseMessage(%v, %d bytes) = %#v, want error", tt.id, len(tt.payload), msg)
+		}
+	}
+}
+
+func TestReadMessageLengthCap(t *testing.T) {
+	var prefix [4]byte
+	binary.BigEndian.PutUint32(prefix[:], MaxMessageLength+1)
+	// Nothing follows the prefix: the payload must not be read or allocated.
+	_, err := ReadMessage(bytes.NewReader(prefix[:]))
+	if !errors.Is(err, ErrMessageTooLong) {
+		t.Errorf("ReadMessage = %v, want ErrMessageTooLong", err)
+	}
+
+	binary.BigEndian.PutUint32(prefix[:], 0xffffffff)
+	if _, err := ReadMessage(bytes.NewReader(prefix[:])); !errors.Is(err, ErrMessageTooLong) {
+		t.Errorf("ReadMessage of a 4 GiB message = %v, want ErrMessageTooLong", err)
+	}
+
+	// A message of exactly the maximum length is accepted.
+	var buf bytes.Buffer
+	block := make([]byte, MaxMessageLength-9)
+	if err := WriteMessage(&buf, Piece{Block: block}); err != nil {
+		t.Fatalf("WriteMessage: %v", err)
+	}
+	if _, err := ReadMessage(&buf); err != nil {
+		t.Errorf("ReadMessage of a maximum length message: %v", err)
+	}
+}
+
+func TestReadMessageTruncated(t *testing.T) {
+	var buf bytes.Buffer
+	WriteMessage(&buf, Request{Index: 1, Begin: 2, Length: 3})
+	wire := buf.Bytes()
+	for i := 1; i < len(wire); i++ {
+		_, err := ReadMessage(bytes.NewReader(wire[:i]))
+		if !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("ReadMessage of %d of %d bytes = %v, want io.ErrUnexpectedEOF", i, len(wire), err)
+		}
+	}
+	if _, err := ReadMessage(bytes.NewReader(nil)); err != io.EOF {
+		t.Errorf("ReadMessage of no input = %v, want io.EOF", err)
+	}
+}
+
+func TestMessageIDString(t *testing.T) {
+	if got := MsgHaveNone.String(); got != "have none" {
+		t.Errorf("MsgHaveNone.String() = %q", got)
+	}
+	if got := MessageID(200).String(); !strings.Contains(got, "200") {
+		t.Errorf("MessageID(200).String() = %q", got)
+	}
+}
@@ -0,0 +1,130 @@
+package tracker
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxResponseSize bounds the size of a tracker response read into memory. A
+// response with MaxPeers IPv4 and IPv6 peers is about 24 KiB.
+const maxResponseSize = 1 << 20
+
+// Request holds the parameters of an announce.
+type Request struct {
+	InfoHash [20]byte
+	PeerID   [20]byte
+	Port     uint16
+
+	Uploaded   int64
+	Downloaded int64
+	Left       int64
+	// Event is "started", "completed", "stopped" or empty for a regular announce.
+	Event string
+
+	// ExtraParams are added to the announce query, replacing standard parameters of the same name.
+	ExtraParams url.Values
+}
+
+// HTTP announces to and scrapes HTTP and HTTPS trackers.
+type HTTP struct {
+	client *http.Client
+}
+
+// NewHTTP returns a client for HTTP and HTTPS trackers that sends its
+// requests through client. A nil client uses one with a 30 second timeout.
+func NewHTTP(client *http.Client) *HTTP {
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	return &HTTP{client: client}
+}
+
+// Announce announces req to the tracker at trackerURL.
+func (h *HTTP) Announce(trackerURL *url.URL, req Request) (*Response, error) {
+	body, err := h.get(announceURL(trackerURL, req))
+	if err != nil {
+		return nil, fmt.Errorf("failed to announce to tracker: %w", err)
+	}
+	return parseTrackerResponse(body)
+}
+
+// Scrape asks the tracker at trackerURL for the swarm statistics of infoHash.
+func (h *HTTP) Scrape(trackerURL *url.URL, infoHash [20]byte) (*ScrapeResponse, error) {
+	scrapeURL, err := ScrapeURL(trackerURL, infoHash)
+	if err != nil {
+		return nil, err
+	}
+	body, err := h.get(scrapeURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scrape tracker: %w", err)
+	}
+	return parseScrapeResponse(body, infoHash)
+}
+
+// get fetches a tracker URL and returns the response body.
+func (h *HTTP) get(u string) ([]byte, error) {
+	resp, err := h.client.Get(u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("tracker returned non-200 status: %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tracker response: %w", err)
+	}
+	if len(body) > maxResponseSize {
+		return nil, fmt.Errorf("tracker response is larger than %d bytes", maxResponseSize)
+	}
+	return body, nil
+}
+
+// announceURL constructs the announce URL for req. Query parameters already
+// in the announce URL, such as a private tracker's passkey, are kept.
+func announceURL(base *url.URL, req Request) string {
+	params := base.Query()
+	params.Set("info_hash", string(req.InfoHash[:]))
+	params.Set("peer_id", string(req.PeerID[:]))
+	params.Set("port", strconv.Itoa(int(req.Port)))
+	params.Set("uploaded", strconv.FormatInt(req.Uploaded, 10))
+	params.Set("downloaded", strconv.FormatInt(req.Downloaded, 10))
+	params.Set("compact", "1")
+	params.Set("left", strconv.FormatInt(req.Left, 10))
+	if req.Event != "" {
+		params.Set("event", req.Event)
+	}
+	for key, values := range req.ExtraParams {
+		params[key] = values
+	}
+
+	u := *base
+	u.RawQuery = params.Encode()
+	return u.String()
+}
+
+// ScrapeURL derives the scrape URL from an announce URL, as described in the
+// scrape convention. It fails for trackers that don't support scraping.
+func ScrapeURL(base *url.URL, infoHash [20]byte) (string, error) {
+	dir, last := path.Split(base.Path)
+	if !strings.HasPrefix(last, "announce") {
+		return "", fmt.Errorf("tracker %s does not support scrape", base.Redacted())
+	}
+
+	u := *base
+	u.Path = dir + "scrape" + strings.TrimPrefix(last, "announce")
+	u.RawPath = ""
+	params := base.Query()
+	params.Set("info_hash", string(infoHash[:]))
+	u.RawQuery = params.Encode()
+	return u.String(), nil
+}
@@ -0,0 +1,37 @@
+package tracker
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestAnnounceURLLargeLeft(t *testing.T) {
+	base, _ := url.Parse("http://tracker.example/announce?passkey=abc")
+	u, err := url.Parse(announceURL(base, Request{Port: 6881, Left: 5 << 30, Downloaded: 1 << 32}))
+	if err != nil {
+		t.Fatalf("announceURL produced an invalid URL: %v", err)
+	}
+	q := u.Query()
+	if got := q.Get("left"); got != "5368709120" {
+		t.Errorf("left = %s, want 5368709120", got)
+	}
+	if got := q.Get("downloaded"); got != "4294967296" {
+		t.Errorf("downloaded = %s, want 4294967296", got)
+	}
+	if got := q.Get("passkey"); got != "abc" {
+		t.Errorf("passkey = %q, want it kept", got)
+	}
+}
+
+func TestGetLimitsResponseSize(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(make([]byte, maxResponseSize+1))
+	}))
+	defer srv.Close()
+
+	if _, err := NewHTTP(srv.Client()).get(srv.URL); err == nil {
+		t.Error("get accepted a response larger than maxResponseSize")
+	}
+}
@@ -0,0 +1,221 @@
+// Package tracker announces to and scrapes BitTorrent trackers. It only deals
+// in info hashes, so tools that don't download anything, such as indexers and
+// monitors, can use it without loading torrents.
+package tracker
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+
+	"github.com/ayu-ch/bittorrent-client/pkg/bencode"
+	"github.com/ayu-ch/bittorrent-client/pkg/netutil"
+)
+
+// MaxPeers bounds the number of peers accepted from a single tracker response.
+const MaxPeers = 1000
+
+// Response holds the result of an announce.
+type Response struct {
+	Interval   int
+	Complete   int
+	Incomplete int
+	Peers      []Peer
+	// ExternalIP is our address as seen by the tracker (BEP 24), or nil if it didn't say.
+	ExternalIP net.IP
+}
+
+// ScrapeResponse holds the swarm statistics a tracker reports for an info hash.
+type ScrapeResponse struct {
+	Complete   int
+	Downloaded int
+	Incomplete int
+}
+
+// Peer is the address of a peer returned by a tracker.
+type Peer struct {
+	IP   net.IP
+	Port uint16
+}
+
+func (p Peer) String() string {
+	return net.JoinHostPort(p.IP.String(), strconv.Itoa(int(p.Port)))
+}
+
+// decodeTrackerDict unmarshals a tracker response and reports a failure reason sent by the tracker.
+func decodeTrackerDict(data []byte) (map[string]any, error) {
+	var response any
+	if err := bencode.Unmarshal(data, &response); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal tracker response: %w", err)
+	}
+
+	trackerData, ok := response.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("tracker response is not a dictionary, got %T", response)
+	}
+
+	if reason, ok := trackerData["failure reason"].(string); ok {
+		return nil, fmt.Errorf("tracker failure: %s", reason)
+	}
+	return trackerData, nil
+}
+
+// parseTrackerResponse parses the bencoded response from the tracker.
+func parseTrackerResponse(data []byte) (*Response, error) {
+	trackerData, err := decodeTrackerDict(data)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &Response{}
+
+	// Extract interval
+	interval, ok := trackerData["interval"].(int64)
+	if !ok {
+		return nil, fmt.Errorf("invalid or missing interval in tracker response")
+	}
+	resp.Interval = int(interval)
+
+	// Seeder and leecher counts are optional
+	resp.Complete = intField(trackerData, "complete")
+	resp.Incomplete = intField(trackerData, "incomplete")
+
+	// Extract peers
+	peersData, ok := trackerData["peers"]
+	if !ok {
+		return nil, fmt.Errorf("missing peers in tracker response")
+	}
+	switch peers := peersData.(type) {
+	case string:
+		if resp.Peers, err = parsePeers(peers, 6, MaxPeers, netutil.DecodeCompactPeers); err != nil {
+			return nil, fmt.Errorf("invalid peers: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("invalid peers data type")
+	}
+
+	// IPv6 peers are returned separately (BEP 7). They are optional, so a
+	// malformed list is skipped rather than losing the IPv4 peers too.
+	if peers6, ok := trackerData["peers6"].(string); ok {
+		if parsed, err := parsePeers(peers6, 18, MaxPeers-len(resp.Peers), netutil.DecodeCompactPeers6); err == nil {
+			resp.Peers = append(resp.Peers, parsed...)
+		}
+	}
+
+	if ip, ok := trackerData["external ip"].(string); ok {
+		resp.ExternalIP = parseExternalIP(ip)
+	}
+
+	return resp, nil
+}
+
+// parseScrapeResponse extracts the statistics for infoHash from a bencoded scrape response.
+func parseScrapeResponse(data []byte, infoHash [20]byte) (*ScrapeResponse, error) {
+	trackerData, err := decodeTrackerDict(data)
+	if err != nil {
+		return nil, err
+	}
+
+	files, ok := trackerData["files"].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("invalid or missing files in scrape response")
+	}
+	stats, ok := files[string(infoHash[:])].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("torrent not found in scrape response")
+	}
+
+	resp := &ScrapeResponse{}
+	resp.Complete = intField(stats, "complete")
+	resp.Downloaded = intField(stats, "downloaded")
+	resp.Incomplete = intField(stats, "incomplete")
+	return resp, nil
+}
+
+// intField returns an optional integer field of a tracker dictionary, or zero if it is missing.
+func intField(m map[string]any, key string) int {
+	v, _ := m[key].(int64)
+	return int(v)
+}
+
+// parseExternalIP decodes the "external ip" field, which BEP 24 defines as a
+// 4 or 16 byte binary address but some trackers send as text.
+func parseExternalIP(s string) net.IP {
+	if addr, err := netip.ParseAddr(s); err == nil {
+		return net.IP(addr.AsSlice())
+	}
+	if len(s) == net.IPv4len || len(s) == net.IPv6len {
+		return net.IP(s)
+	}
+	return nil
+}
+
+// parsePeers decodes at most limit entries of a compact peer list with the
+// given decoder, dropping addresses that can't be peers.
+func parsePeers(peers string, entrySize, limit int, decode func([]byte) ([]netip.AddrPort, error)) ([]Peer, error) {
+	if len(peers)%entrySize != 0 {
+		return nil, fmt.Errorf("compact peers length %d is not a multiple of %d", len(peers), entrySize)
+	}
+	// Only decode what will be kept, so a huge response can't make us allocate for all of it.
+	if limit <= 0 {
+		return nil, nil
+	}
+	if len(peers)/entrySize > limit {
+		peers = peers[:limit*entrySize]
+	}
+	addrs, err := decode([]byte(peers))
+	if err != nil {
+		return nil, err
+	}
+	result := make([]Peer, 0, len(addrs))
+	for _, addr := range addrs {
+		if validPeerAddr(addr) {
+			result = append(result, Peer{IP: net.IP(addr.Addr().AsSlice()), Port: addr.Port()})
+		}
+	}
+	return result, nil
+}
+
+// bogonPrefixes are address ranges that can't hold a reachable peer:
+// "this network", loopback, link-local, carrier-grade NAT, documentation and
+// benchmarking ranges, multicast and reserved space. Private ranges are not
+// among them, so swarms on a LAN keep working.
+var bogonPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("127.0.0.0/8"),
+	netip.MustParsePrefix("169.254.0.0/16"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("192.0.2.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("198.51.100.0/24"),
+	netip.MustParsePrefix("203.0.113.0/24"),
+	netip.MustParsePrefix("224.0.0.0/4"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+
+	netip.MustParsePrefix("::/96"),
+	netip.MustParsePrefix("::1/128"),
+	netip.MustParsePrefix("100::/64"),
+	netip.MustParsePrefix("2001:10::/28"),
+	netip.MustParsePrefix("2001:db8::/32"),
+	netip.MustParsePrefix("3fff::/20"),
+	netip.MustParsePrefix("fe80::/10"),
+	netip.MustParsePrefix("fec0::/10"),
+	netip.MustParsePrefix("ff00::/8"),
+}
+
+// validPeerAddr reports whether addr could belong to a real peer. Port 0 and
+// bogon addresses can't, and are dropped.
+func validPeerAddr(addr netip.AddrPort) bool {
+	ip := addr.Addr().Unmap()
+	if addr.Port() == 0 {
+		return false
+	}
+	for _, p := range bogonPrefixes {
+		if p.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,88 @@
+package tracker
+
+import (
+	"net/netip"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestValidPeerAddr(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"203.0.114.1:6881", true},
+		{"10.0.0.1:6881", true},
+		{"192.168.1.2:80", true},
+		{"[2001:4860::1]:6881", true},
+		{"[fd00::1]:6881", true},
+		{"[::ffff:8.8.8.8]:6881", true},
+		{"8.8.8.8:0", false},
+		{"0.0.0.0:6881", false},
+		{"0.1.2.3:6881", false},
+		{"127.0.0.1:6881", false},
+		{"169.254.1.1:6881", false},
+		{"100.64.0.1:6881", false},
+		{"192.0.2.1:6881", false},
+		{"198.18.0.1:6881", false},
+		{"198.51.100.1:6881", false},
+		{"203.0.113.1:6881", false},
+		{"224.0.0.1:6881", false},
+		{"240.0.0.1:6881", false},
+		{"255.255.255.255:6881", false},
+		{"[::]:6881", false},
+		{"[::1]:6881", false},
+		{"[::ffff:127.0.0.1]:6881", false},
+		{"[fe80::1]:6881", false},
+		{"[fec0::1]:6881", false},
+		{"[ff02::1]:6881", false},
+		{"[2001:db8::1]:6881", false},
+		{"[100::1]:6881", false},
+	}
+	for _, tt := range tests {
+		if got := validPeerAddr(netip.MustParseAddrPort(tt.addr)); got != tt.want {
+			t.Errorf("validPeerAddr(%s) = %t, want %t", tt.addr, got, tt.want)
+		}
+	}
+}
+
+// compactPeer returns the compact form of an IPv4 peer.
+func compactPeer(a, b, c, d byte, port uint16) string {
+	return string([]byte{a, b, c, d, byte(port >> 8), byte(port)})
+}
+
+func TestParseTrackerResponseDropsBogons(t *testing.T) {
+	peers := compactPeer(8, 8, 8, 8, 6881) + compactPeer(127, 0, 0, 1, 6881) + compactPeer(8, 8, 4, 4, 0)
+	data := "d8:intervali1800e5:peers18:" + peers + "e"
+	resp, err := parseTrackerResponse([]byte(data))
+	if err != nil {
+		t.Fatalf("parseTrackerResponse: %v", err)
+	}
+	if len(resp.Peers) != 1 || resp.Peers[0].String() != "8.8.8.8:6881" {
+		t.Errorf("got peers %v, want only 8.8.8.8:6881", resp.Peers)
+	}
+}
+
+func TestParseTrackerResponseSkipsInvalidPeers6(t *testing.T) {
+	data := "d8:intervali1800e5:peers6:" + compactPeer(8, 8, 8, 8, 6881) + "6:peers65:abcdee"
+	resp, err := parseTrackerResponse([]byte(data))
+	if err != nil {
+		t.Fatalf("parseTrackerResponse: %v", err)
+	}
+	if len(resp.Peers) != 1 {
+		t.Errorf("got peers %v, want the IPv4 peer", resp.Peers)
+	}
+}
+
+func TestParseTrackerResponseCapsPeers(t *testing.T) {
+	peers := strings.Repeat(compactPeer(8, 8, 8, 8, 6881), MaxPeers+10)
+	data := "d8:intervali1800e5:peers" + strconv.Itoa(len(peers)) + ":" + peers + "e"
+	resp, err := parseTrackerResponse([]byte(data))
+	if err != nil {
+		t.Fatalf("parseTrackerResponse: %v", err)
+	}
+	if len(resp.Peers) != MaxPeers {
+		t.Errorf("got %d peers, want %d", len(resp.Peers), MaxPeers)
+	}
+}
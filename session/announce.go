@@ -0,0 +1,417 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ayu-ch/bittorrent-client/torrent"
+)
+
+const (
+	// DefaultAnnounceSpread is the window over which AnnounceAll spreads announces.
+	DefaultAnnounceSpread = 10 * time.Second
+	// DefaultTrackerHostConcurrency is the number of concurrent announces allowed per tracker host.
+	DefaultTrackerHostConcurrency = 2
+	// dualStackGrace is how long to wait for the second address family once the first has answered.
+	dualStackGrace = 3 * time.Second
+	// parallelAnnounceGrace is how long announcing to every tracker waits for
+	// the rest once one has answered.
+	parallelAnnounceGrace = 5 * time.Second
+)
+
+// Announce announces t to its trackers and returns the first successful
+// response. Tiers are tried in order; within a tier, trackers whose hosts
+// have delivered the most peers go first. With WithAnnounceToAllTrackers, all
+// trackers are announced to at once instead and their responses merged.
+// While the session is suspended, Announce waits for Resume or for ctx to be
+// cancelled.
+func (s *Session) Announce(ctx context.Context, t *torrent.Torrent) (*torrent.TrackerResponse, error) {
+	if err := s.checkSchedule(t); err != nil {
+		return nil, err
+	}
+	trackers := s.orderTrackers(t)
+	if len(trackers) == 0 {
+		return nil, errors.New("torrent has no trackers")
+	}
+	if s.healthFile != "" {
+		defer func() {
+			if err := s.saveTrackerHealth(); err != nil {
+				s.logger.Print(err)
+			}
+		}()
+	}
+
+	if s.announceToAll {
+		resp, err := s.announceParallel(ctx, t, trackers)
+		if err == nil {
+			s.rememberPeers(t, resp)
+		}
+		return resp, err
+	}
+
+	var errs []error
+	for _, tracker := range trackers {
+		resp, err := s.AnnounceTo(ctx, t, tracker)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if err != nil {
+			s.logger.Printf("announce to %s failed: %v", tracker, err)
+			errs = append(errs, fmt.Errorf("%s: %w", tracker, err))
+			continue
+		}
+		s.logger.Printf("announced to %s: %d peers", tracker, len(resp.Peers))
+		s.rememberPeers(t, resp)
+		return resp, nil
+	}
+	return nil, errors.Join(errs...)
+}
+
+// announceParallel announces t to every tracker concurrently and merges the
+// successful responses. Once one tracker has answered, the others get
+// parallelAnnounceGrace to catch up, so a hanging tracker can't hold up the
+// peers already found. It fails only if every tracker does or ctx is
+// cancelled before any answers.
+func (s *Session) announceParallel(ctx context.Context, t *torrent.Torrent, trackers []string) (*torrent.TrackerResponse, error) {
+	type result struct {
+		tracker string
+		resp    *torrent.TrackerResponse
+		err     error
+	}
+	results := make(chan result, len(trackers))
+	for _, tracker := range trackers {
+		go func() {
+			resp, err := s.AnnounceTo(ctx, t, tracker)
+			results <- result{tracker: tracker, resp: resp, err: err}
+		}()
+	}
+
+	var merged *torrent.TrackerResponse
+	var errs []error
+	var grace <-chan time.Time
+	for received := 0; received < len(trackers); {
+		select {
+		case r := <-results:
+			received++
+			if r.err != nil {
+				s.logger.Printf("announce to %s failed: %v", r.tracker, r.err)
+				errs = append(errs, fmt.Errorf("%s: %w", r.tracker, r.err))
+				continue
+			}
+			s.logger.Printf("announced to %s: %d peers", r.tracker, len(r.resp.Peers))
+			merged = mergeResponses(merged, r.resp)
+			if grace == nil {
+				grace = time.After(parallelAnnounceGrace)
+			}
+		case <-grace:
+			s.logger.Printf("announced to %d of %d trackers, not waiting for the rest", received, len(trackers))
+			return merged, nil
+		case <-ctx.Done():
+			if merged != nil {
+				return merged, nil
+			}
+			return nil, ctx.Err()
+		}
+	}
+	if merged == nil {
+		return nil, errors.Join(errs...)
+	}
+	return merged, nil
+}
+
+// AnnounceTo announces t to a single tracker, waiting for a free slot on the
+// tracker's host. If the tracker publishes several endpoints in DNS they are
+// tried in order until one answers. While the session is suspended,
+// AnnounceTo waits for Resume or for ctx to be cancelled.
+func (s *Session) AnnounceTo(ctx context.Context, t *torrent.Torrent, tracker string) (*torrent.TrackerResponse, error) {
+	if err := s.waitResumed(ctx); err != nil {
+		return nil, err
+	}
+	resp, err := s.announceEvent(t, tracker, "")
+	if err != nil {
+		s.recordAnnounce(tracker, 0, err)
+		return nil, err
+	}
+	s.recordAnnounce(tracker, len(resp.Peers), nil)
+	s.noteAnnounced(t, tracker)
+	return resp, nil
+}
+
+// AnnounceStopped tells tracker that we have left t's swarm, so it stops
+// handing out our address. Like AnnounceTo, it waits while the session is
+// suspended.
+func (s *Session) AnnounceStopped(ctx context.Context, t *torrent.Torrent, tracker string) error {
+	if err := s.waitResumed(ctx); err != nil {
+		return err
+	}
+	if _, err := s.announceEvent(t, tracker, "stopped"); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	if m, ok := s.torrents[t.InfoHash]; ok {
+		delete(m.announced, tracker)
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+// announceEvent announces t to tracker with the given event, trying the
+// tracker's endpoints in order until one answers.
+func (s *Session) announceEvent(t *torrent.Torrent, tracker, event string) (*torrent.TrackerResponse, error) {
+	urls, err := s.trackerURLs(tracker)
+	if err != nil {
+		return nil, err
+	}
+	req := s.announceRequest(t, tracker)
+	req.Event = event
+
+	var errs []error
+	for _, u := range urls {
+		resp, err := s.announceURL(u, t, req)
+		if err == nil {
+			return resp, nil
+		}
+		errs = append(errs, err)
+	}
+	return nil, errors.Join(errs...)
+}
+
+// announceURL announces t to one tracker endpoint.
+func (s *Session) announceURL(u *url.URL, t *torrent.Torrent, req torrent.AnnounceRequest) (*torrent.TrackerResponse, error) {
+	client, err := s.trackerClient(u)
+	if err != nil {
+		return nil, err
+	}
+	release := s.acquireHost(u.Hostname())
+	defer release()
+
+	var resp *torrent.TrackerResponse
+	if s.dualStack && client == s.httpTracker {
+		resp, err = s.announceDualStack(u, t, req)
+	} else {
+		resp, err = client.Announce(u, t, req)
+		if err == nil {
+			s.noteExternalIP(resp.ExternalIP)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	resp.Peers = s.withoutSelf(resp.Peers, req.Port)
+	return resp, nil
+}
+
+// announceRequest builds the announce parameters for t on tracker from the session and torrent options.
+func (s *Session) announceRequest(t *torrent.Torrent, tracker string) torrent.AnnounceRequest {
+	req := torrent.AnnounceRequest{PeerID: s.peerID, Port: s.listenPort}
+
+	s.mu.Lock()
+	m, ok := s.torrents[t.InfoHash]
+	s.mu.Unlock()
+	if !ok {
+		return req
+	}
+	if m.opts.ListenPort != 0 {
+		req.Port = m.opts.ListenPort
+	}
+
+	params := url.Values{}
+	for key, values := range m.opts.AnnounceParams {
+		params[key] = values
+	}
+	for key, values := range m.opts.TrackerParams[tracker] {
+		params[key] = values
+	}
+	if len(params) > 0 {
+		req.ExtraParams = params
+	}
+	return req
+}
+
+// announceDualStack announces separately over IPv4 and IPv6, as suggested by
+// BEP 7, so the tracker lists us under both addresses, and merges the peers.
+// Once one family has answered, the other gets dualStackGrace to catch up.
+func (s *Session) announceDualStack(u *url.URL, t *torrent.Torrent, req torrent.AnnounceRequest) (*torrent.TrackerResponse, error) {
+	type result struct {
+		family string
+		resp   *torrent.TrackerResponse
+		err    error
+	}
+	results := make(chan result, 2)
+	announce := func(family string, client torrent.TrackerClient) {
+		resp, err := client.Announce(u, t, req)
+		if err == nil {
+			s.noteExternalIP(resp.ExternalIP)
+		}
+		results <- result{family: family, resp: resp, err: err}
+	}
+	go announce("ipv4", s.httpTracker4)
+	go announce("ipv6", s.httpTracker6)
+
+	var merged *torrent.TrackerResponse
+	var errs []error
+	var grace <-chan time.Time
+	for received := 0; received < 2; {
+		select {
+		case r := <-results:
+			received++
+			if r.err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", r.family, r.err))
+				continue
+			}
+			merged = mergeResponses(merged, r.resp)
+			grace = time.After(dualStackGrace)
+		case <-grace:
+			return merged, nil
+		}
+	}
+	if merged == nil {
+		return nil, errors.Join(errs...)
+	}
+	return merged, nil
+}
+
+// mergeResponses combines two announce responses, dropping duplicate peers.
+func mergeResponses(a, b *torrent.TrackerResponse) *torrent.TrackerResponse {
+	if a == nil {
+		return b
+	}
+	merged := &torrent.TrackerResponse{
+		Interval:   min(a.Interval, b.Interval),
+		Complete:   max(a.Complete, b.Complete),
+		Incomplete: max(a.Incomplete, b.Incomplete),
+		ExternalIP: a.ExternalIP,
+	}
+	if merged.ExternalIP == nil {
+		merged.ExternalIP = b.ExternalIP
+	}
+	seen := make(map[string]bool)
+	for _, peer := range append(a.Peers, b.Peers...) {
+		if key := peer.String(); !seen[key] {
+			seen[key] = true
+			merged.Peers = append(merged.Peers, peer)
+		}
+	}
+	return merged
+}
+
+// AnnounceResult is the outcome of announcing one torrent.
+type AnnounceResult struct {
+	Torrent  *torrent.Torrent
+	Response *torrent.TrackerResponse
+	Err      error
+}
+
+// AnnounceAll announces every torrent in the session and sends each result on
+// the returned channel as it completes; the channel is closed once all are
+// done. Start times are spread randomly over the announce spread so that many
+// torrents sharing a tracker don't hit it all at once, and each tracker host
+// only sees a limited number of concurrent announces. Torrents scheduled to
+// start later are announced once their start time comes. While the session is
+// suspended, announces wait for Resume. Torrents that hadn't started when ctx
+// is cancelled report ctx's error.
+func (s *Session) AnnounceAll(ctx context.Context) <-chan AnnounceResult {
+	torrents := s.Torrents()
+	results := make(chan AnnounceResult, len(torrents))
+
+	var wg sync.WaitGroup
+	for _, t := range torrents {
+		wg.Add(1)
+		go func(t *torrent.Torrent) {
+			defer wg.Done()
+			var delay time.Duration
+			if s.announceSpread > 0 {
+				delay = rand.N(s.announceSpread)
+			}
+			delay += s.untilStart(t)
+			if delay > 0 {
+				timer := time.NewTimer(delay)
+				defer timer.Stop()
+				select {
+				case <-timer.C:
+				case <-ctx.Done():
+					results <- AnnounceResult{Torrent: t, Err: ctx.Err()}
+					return
+				}
+			}
+			if err := s.waitResumed(ctx); err != nil {
+				results <- AnnounceResult{Torrent: t, Err: err}
+				return
+			}
+			resp, err := s.Announce(ctx, t)
+			results <- AnnounceResult{Torrent: t, Response: resp, Err: err}
+		}(t)
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+	return results
+}
+
+// acquireHost waits for an announce slot on host and returns a function releasing it.
+func (s *Session) acquireHost(host string) func() {
+	host = strings.ToLower(host)
+	s.hostMu.Lock()
+	sem, ok := s.hostSems[host]
+	if !ok {
+		sem = make(chan struct{}, s.hostSlots)
+		s.hostSems[host] = sem
+	}
+	s.hostMu.Unlock()
+
+	sem <- struct{}{}
+	return func() { <-sem }
+}
+
+// trackerClient returns the client for u, using the session's dialer for HTTP trackers.
+func (s *Session) trackerClient(u *url.URL) (torrent.TrackerClient, error) {
+	_, client, err := torrent.LookupTrackerClient(u.String())
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+		client = s.httpTracker
+	}
+	return client, nil
+}
+
+// Scrape asks a single tracker for the swarm statistics of t. Like
+// AnnounceTo, it tries the endpoints the tracker publishes in DNS in order,
+// skipping those whose protocol has no client, until one answers, and waits
+// while the session is suspended.
+func (s *Session) Scrape(ctx context.Context, t *torrent.Torrent, tracker string) (*torrent.ScrapeResponse, error) {
+	if err := s.waitResumed(ctx); err != nil {
+		return nil, err
+	}
+	urls, err := s.trackerURLs(tracker)
+	if err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	for _, u := range urls {
+		client, err := s.trackerClient(u)
+		if errors.Is(err, torrent.ErrUnsupportedTrackerScheme) {
+			continue
+		}
+		if err == nil {
+			var resp *torrent.ScrapeResponse
+			if resp, err = client.Scrape(u, t); err == nil {
+				return resp, nil
+			}
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", u.Redacted(), err))
+	}
+	if len(errs) == 0 {
+		return nil, fmt.Errorf("%w: no endpoint of %s has a supported protocol", torrent.ErrUnsupportedTrackerScheme, tracker)
+	}
+	return nil, errors.Join(errs...)
+}
@@ -0,0 +1,144 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/ayu-ch/bittorrent-client/torrent"
+)
+
+// peerTracker is an HTTP tracker that answers every announce with the given
+// compact peers, encoded as IPv4 address and port.
+func peerTracker(t *testing.T, interval int, peers ...string) *httptest.Server {
+	var compact []byte
+	for _, p := range peers {
+		addr, err := net.ResolveTCPAddr("tcp4", p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		compact = append(compact, addr.IP.To4()...)
+		compact = append(compact, byte(addr.Port>>8), byte(addr.Port))
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(fmt.Appendf(nil, "d8:intervali%de5:peers%d:%se", interval, len(compact), compact))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func peerStrings(peers []torrent.Peer) []string {
+	var s []string
+	for _, p := range peers {
+		s = append(s, p.String())
+	}
+	slices.Sort(s)
+	return s
+}
+
+func TestMergeResponses(t *testing.T) {
+	a := &torrent.TrackerResponse{
+		Interval: 1800, Complete: 5, Incomplete: 1,
+		Peers: []torrent.Peer{{IP: net.IPv4(10, 0, 0, 1), Port: 1}, {IP: net.IPv4(10, 0, 0, 2), Port: 2}},
+	}
+	b := &torrent.TrackerResponse{
+		Interval: 900, Complete: 3, Incomplete: 4, ExternalIP: net.IPv4(192, 0, 2, 1),
+		Peers: []torrent.Peer{{IP: net.IPv4(10, 0, 0, 2), Port: 2}, {IP: net.IPv4(10, 0, 0, 3), Port: 3}},
+	}
+	if got := mergeResponses(nil, b); got != b {
+		t.Errorf("merging into nil = %v, want the response itself", got)
+	}
+
+	got := mergeResponses(a, b)
+	if got.Interval != 900 || got.Complete != 5 || got.Incomplete != 4 {
+		t.Errorf("interval, complete, incomplete = %d, %d, %d, want 900, 5, 4", got.Interval, got.Complete, got.Incomplete)
+	}
+	if !got.ExternalIP.Equal(b.ExternalIP) {
+		t.Errorf("external IP = %v, want %v", got.ExternalIP, b.ExternalIP)
+	}
+	want := []string{"10.0.0.1:1", "10.0.0.2:2", "10.0.0.3:3"}
+	if peers := peerStrings(got.Peers); !slices.Equal(peers, want) {
+		t.Errorf("peers = %v, want %v", peers, want)
+	}
+}
+
+func TestAnnounceToAllTrackers(t *testing.T) {
+	first := peerTracker(t, 1800, "10.0.0.1:6881", "10.0.0.2:6881")
+	second := peerTracker(t, 600, "10.0.0.2:6881", "10.0.0.3:6881")
+	broken := httptest.NewServer(http.NotFoundHandler())
+	t.Cleanup(broken.Close)
+
+	s, err := NewSession(WithDualStackAnnounce(false), WithDNSTrackerPreferences(false), WithAnnounceToAllTrackers(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tor := &torrent.Torrent{
+		InfoHash: [20]byte{1},
+		Info:     torrent.Info{Name: "a", Length: 100},
+		AnnounceList: [][]string{
+			{first.URL + "/announce"},
+			{second.URL + "/announce", broken.URL + "/announce", "udp://tracker.invalid:6969/announce"},
+		},
+	}
+	s.AddTorrent(tor, nil)
+
+	resp, err := s.Announce(context.Background(), tor)
+	if err != nil {
+		t.Fatalf("Announce: %v", err)
+	}
+	if resp.Interval != 600 {
+		t.Errorf("interval = %d, want the shortest, 600", resp.Interval)
+	}
+	want := []string{"10.0.0.1:6881", "10.0.0.2:6881", "10.0.0.3:6881"}
+	if peers := peerStrings(resp.Peers); !slices.Equal(peers, want) {
+		t.Errorf("peers = %v, want %v", peers, want)
+	}
+
+	stats := s.ProtocolStats()
+	if got, want := stats["http"], (TrackerHealth{Announces: 3, Failures: 1, Peers: 4}); got != want {
+		t.Errorf("http stats = %+v, want %+v", got, want)
+	}
+	if got, want := stats["udp"], (TrackerHealth{Announces: 1, Failures: 1}); got != want {
+		t.Errorf("udp stats = %+v, want %+v", got, want)
+	}
+}
+
+func TestAnnounceToAllTrackersHanging(t *testing.T) {
+	ok := peerTracker(t, 1800, "10.0.0.1:6881")
+	hang := make(chan struct{})
+	hanging := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-hang
+	}))
+	t.Cleanup(hanging.Close)
+	t.Cleanup(func() { close(hang) })
+
+	s, err := NewSession(WithDualStackAnnounce(false), WithDNSTrackerPreferences(false), WithAnnounceToAllTrackers(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tor := &torrent.Torrent{
+		InfoHash:     [20]byte{1},
+		Info:         torrent.Info{Name: "a", Length: 100},
+		AnnounceList: [][]string{{ok.URL + "/announce", hanging.URL + "/announce"}},
+	}
+	s.AddTorrent(tor, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	resp, err := s.Announce(ctx, tor)
+	if err != nil {
+		t.Fatalf("Announce: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > parallelAnnounceGrace {
+		t.Errorf("Announce took %v waiting for a hanging tracker", elapsed)
+	}
+	if len(resp.Peers) != 1 {
+		t.Errorf("got %d peers, want the answering tracker's 1", len(resp.Peers))
+	}
+}
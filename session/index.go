@@ -0,0 +1,186 @@
+package session
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ayu-ch/bittorrent-client/torrent"
+)
+
+// IndexEntry describes a torrent that was added to a session. The index keeps
+// entries after the torrent is removed, so it answers which torrent a file
+// came from long after the fact.
+type IndexEntry struct {
+	InfoHash string      `json:"info_hash"`
+	Name     string      `json:"name"`
+	Size     int64       `json:"size"`
+	Files    []IndexFile `json:"files"`
+	Labels   []string    `json:"labels,omitempty"`
+	Added    time.Time   `json:"added"`
+}
+
+// IndexFile is a file of an indexed torrent, with its path joined by slashes.
+type IndexFile struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+// SearchResult is a torrent matching a search. MatchedFiles lists the files
+// whose paths matched; it is empty if only the name, a label or the info hash did.
+type SearchResult struct {
+	IndexEntry
+	MatchedFiles []IndexFile `json:"matched_files"`
+}
+
+// Search returns the indexed torrents whose name, labels, file paths or info
+// hash contain query, ignoring case, most recently added first.
+func (s *Session) Search(query string) []SearchResult {
+	query = strings.ToLower(query)
+	contains := func(s string) bool { return strings.Contains(strings.ToLower(s), query) }
+
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+	var results []SearchResult
+	for _, e := range s.index {
+		r := SearchResult{IndexEntry: e}
+		for _, f := range e.Files {
+			if contains(f.Path) {
+				r.MatchedFiles = append(r.MatchedFiles, f)
+			}
+		}
+		if len(r.MatchedFiles) > 0 || contains(e.Name) || strings.HasPrefix(e.InfoHash, query) || slices.ContainsFunc(e.Labels, contains) {
+			results = append(results, r)
+		}
+	}
+	slices.SortFunc(results, func(a, b SearchResult) int {
+		return b.Added.Compare(a.Added)
+	})
+	return results
+}
+
+// indexTorrent records t in the index, adding labels to an existing entry,
+// and saves the index file if anything changed.
+func (s *Session) indexTorrent(t *torrent.Torrent, labels []string) {
+	if s.indexFile == "" {
+		return
+	}
+	key := fmt.Sprintf("%x", t.InfoHash)
+
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+	e, ok := s.index[key]
+	if !ok {
+		e = IndexEntry{InfoHash: key, Name: t.Info.Name, Size: t.Info.TotalLength(), Added: time.Now().UTC()}
+		for _, f := range t.Info.FileExtents() {
+			e.Files = append(e.Files, IndexFile{Path: strings.Join(f.Path, "/"), Size: f.Length})
+		}
+	}
+	changed := !ok
+	for _, label := range labels {
+		if !slices.Contains(e.Labels, label) {
+			e.Labels = append(e.Labels, label)
+			changed = true
+		}
+	}
+	if !changed {
+		return
+	}
+	s.index[key] = e
+
+	// Appending keeps the cost of adding a torrent independent of the size
+	// of the index; loadIndex drops the superseded records.
+	if err := s.appendIndex(e); err != nil {
+		s.logger.Printf("failed to save torrent index: %v", err)
+	}
+}
+
+// appendIndex appends e to the index log.
+func (s *Session) appendIndex(e IndexEntry) error {
+	record, err := encodeStateRecord(e)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.indexFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(record, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// loadIndex replays the index log, if there is one yet; a later record of a
+// torrent replaces earlier ones. Damaged records, such as a line torn by a
+// crash, are skipped. Unless the state directory is read-only, the log is
+// rewritten without them, and without superseded records once those make
+// up most of it.
+func (s *Session) loadIndex() error {
+	f, err := os.Open(s.indexFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read torrent index: %w", err)
+	}
+	defer f.Close()
+
+	records, damaged := 0, 0
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			var e IndexEntry
+			if decodeStateRecord(line, &e) != nil || e.InfoHash == "" {
+				damaged++
+			} else {
+				s.index[e.InfoHash] = e
+				records++
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read torrent index %s: %w", s.indexFile, err)
+		}
+	}
+	if damaged > 0 {
+		s.logger.Printf("skipped %d damaged records of torrent index %s", damaged, s.indexFile)
+	}
+	if !s.stateReadOnly && (damaged > 0 || records > 2*len(s.index)) {
+		return s.compactIndex()
+	}
+	return nil
+}
+
+// compactIndex rewrites the index log with one record per torrent, oldest first.
+func (s *Session) compactIndex() error {
+	entries := slices.Collect(maps.Values(s.index))
+	slices.SortFunc(entries, func(a, b IndexEntry) int {
+		return a.Added.Compare(b.Added)
+	})
+	var buf bytes.Buffer
+	for _, e := range entries {
+		record, err := encodeStateRecord(e)
+		if err != nil {
+			return err
+		}
+		buf.Write(record)
+		buf.WriteByte('\n')
+	}
+	if err := writeFileAtomic(s.indexFile, buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to compact torrent index: %w", err)
+	}
+	return nil
+}
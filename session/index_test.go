@@ -0,0 +1,119 @@
+package session
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ayu-ch/bittorrent-client/torrent"
+)
+
+// indexedTorrent returns a single-file torrent named name.
+func indexedTorrent(b byte, name string) *torrent.Torrent {
+	return &torrent.Torrent{InfoHash: [20]byte{b}, Info: torrent.Info{Name: name, Length: 100}}
+}
+
+func TestIndexAppendAndReload(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewSession(WithStateDir(dir))
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	s.indexTorrent(indexedTorrent(1, "ubuntu.iso"), nil)
+	s.indexTorrent(indexedTorrent(2, "debian.iso"), []string{"linux"})
+	s.indexTorrent(indexedTorrent(1, "ubuntu.iso"), []string{"linux"})
+	// An unchanged entry isn't appended again.
+	s.indexTorrent(indexedTorrent(1, "ubuntu.iso"), []string{"linux"})
+	s.Close()
+
+	data, err := os.ReadFile(filepath.Join(dir, indexFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines != 3 {
+		t.Errorf("index log has %d records, want 3", lines)
+	}
+
+	s, err = NewSession(WithStateDir(dir))
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	defer s.Close()
+	results := s.Search("LINUX")
+	if len(results) != 2 {
+		t.Fatalf("Search(LINUX) returned %d results, want 2", len(results))
+	}
+	if results := s.Search("ubuntu"); len(results) != 1 || len(results[0].Labels) != 1 {
+		t.Errorf("Search(ubuntu) = %+v, want one entry labelled linux", results)
+	}
+}
+
+func TestIndexTornRecord(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewSession(WithStateDir(dir))
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	s.indexTorrent(indexedTorrent(1, "ubuntu.iso"), nil)
+	s.Close()
+
+	name := filepath.Join(dir, indexFileName)
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"sha256":"00","data":{"info_hash":`)
+	f.Close()
+
+	s, err = NewSession(WithStateDir(dir))
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	s.indexTorrent(indexedTorrent(2, "debian.iso"), nil)
+	s.Close()
+
+	s, err = NewSession(WithStateDir(dir))
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	defer s.Close()
+	if results := s.Search(".iso"); len(results) != 2 {
+		t.Errorf("Search(.iso) returned %d results after a torn record, want 2", len(results))
+	}
+}
+
+func TestIndexReadOnly(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewSession(WithStateDir(dir))
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	defer s.Close()
+	s.indexTorrent(indexedTorrent(1, "ubuntu.iso"), nil)
+	s.indexTorrent(indexedTorrent(1, "ubuntu.iso"), []string{"a"})
+	s.indexTorrent(indexedTorrent(1, "ubuntu.iso"), []string{"b"})
+	name := filepath.Join(dir, indexFileName)
+	before, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A read-only session works while s holds the lock, and neither compacts
+	// the log nor records what it adds.
+	ro, err := NewSession(WithReadOnlyStateDir(dir))
+	if err != nil {
+		t.Fatalf("NewSession with a read-only state directory: %v", err)
+	}
+	if results := ro.Search("ubuntu"); len(results) != 1 || len(results[0].Labels) != 2 {
+		t.Errorf("Search(ubuntu) = %+v, want one entry with two labels", results)
+	}
+	ro.indexTorrent(indexedTorrent(2, "debian.iso"), nil)
+	after, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(after) != string(before) {
+		t.Errorf("read-only session changed the index log")
+	}
+}
@@ -0,0 +1,157 @@
+package session
+
+import (
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/ayu-ch/bittorrent-client/torrent"
+)
+
+// AddTorrentOptions configures a single torrent added to a Session.
+type AddTorrentOptions struct {
+	// AnnounceParams are extra query parameters sent with every announce of
+	// the torrent, for private trackers that expect fields such as uploaded_real.
+	AnnounceParams url.Values
+	// TrackerParams are extra query parameters for individual trackers, keyed
+	// by announce URL. They take precedence over AnnounceParams.
+	TrackerParams map[string]url.Values
+	// ListenPort overrides the session's port in announces for this torrent,
+	// for private trackers that require a distinct port per client instance.
+	ListenPort uint16
+	// StartAt delays the torrent's announces until the given time, for
+	// example to keep it off the network until off-peak hours.
+	StartAt time.Time
+	// StopAt removes the torrent from the session once the given time has
+	// passed. From then on Torrents doesn't list it and announcing it fails
+	// with ErrExpired, until it is added again.
+	StopAt time.Time
+	// Labels are free-form tags recorded in the torrent index, to find the
+	// torrent by with Search.
+	Labels []string
+}
+
+// Option configures a Session.
+type Option func(*Session)
+
+// WithListenPort sets the port reported to trackers.
+func WithListenPort(port uint16) Option {
+	return func(s *Session) {
+		s.listenPort = port
+	}
+}
+
+// WithLogger sets the logger used for session activity.
+func WithLogger(logger *log.Logger) Option {
+	return func(s *Session) {
+		s.logger = logger
+	}
+}
+
+// WithDialer sets the dialer used for outgoing tracker connections, for
+// example to route traffic over Tor or a test transport.
+func WithDialer(dialer torrent.Dialer) Option {
+	return func(s *Session) {
+		s.dialer = dialer
+	}
+}
+
+// WithDNSOverHTTPS resolves tracker host names through the DNS-over-HTTPS
+// server at serverURL, such as https://1.1.1.1/dns-query, so announces keep
+// working where the local DNS blocks trackers. Only the session's own lookups
+// are affected. It has no effect with a proxy dialer, which resolves names itself.
+func WithDNSOverHTTPS(serverURL string) Option {
+	return func(s *Session) {
+		s.dohURL = serverURL
+	}
+}
+
+// WithExtraTrackers appends trackers to every non-private torrent added to the session.
+func WithExtraTrackers(trackers ...string) Option {
+	return func(s *Session) {
+		s.extraTrackers = append(s.extraTrackers, trackers...)
+	}
+}
+
+// WithTrackerList appends the trackers listed at url, one per line, to every
+// non-private torrent added to the session. The list is fetched again once it
+// is older than refresh, or DefaultTrackerListRefresh if refresh is zero.
+func WithTrackerList(url string, refresh time.Duration) Option {
+	return func(s *Session) {
+		if refresh <= 0 {
+			refresh = DefaultTrackerListRefresh
+		}
+		s.trackerList = &trackerList{url: url, refresh: refresh}
+	}
+}
+
+// WithStateDir keeps the session's state in dir, which is created if
+// needed. DefaultStateDir is the usual choice. Files configured explicitly,
+// such as with WithTrackerHealthFile, are kept where they were asked to be.
+func WithStateDir(dir string) Option {
+	return func(s *Session) {
+		s.stateDir = dir
+	}
+}
+
+// WithReadOnlyStateDir reads the session's state from dir without locking
+// or changing it, so it works while another session is using the directory.
+// Nothing the session learns is saved.
+func WithReadOnlyStateDir(dir string) Option {
+	return func(s *Session) {
+		s.stateDir = dir
+		s.stateReadOnly = true
+	}
+}
+
+// WithTrackerHealthFile keeps the announce history of tracker hosts in the
+// file at path, so the preference for trackers that deliver peers survives
+// restarts.
+func WithTrackerHealthFile(path string) Option {
+	return func(s *Session) {
+		s.healthFile = path
+	}
+}
+
+// WithAnnounceSpread sets the window over which AnnounceAll spreads the
+// announces of all torrents. Zero announces everything immediately.
+func WithAnnounceSpread(spread time.Duration) Option {
+	return func(s *Session) {
+		s.announceSpread = spread
+	}
+}
+
+// WithTrackerHostConcurrency limits how many announces may be in flight to a single tracker host.
+func WithTrackerHostConcurrency(n int) Option {
+	return func(s *Session) {
+		if n > 0 {
+			s.hostSlots = n
+		}
+	}
+}
+
+// WithDualStackAnnounce controls whether HTTP trackers are announced to
+// separately over IPv4 and IPv6. It is enabled by default.
+func WithDualStackAnnounce(enabled bool) Option {
+	return func(s *Session) {
+		s.dualStack = enabled
+	}
+}
+
+// WithDNSTrackerPreferences controls whether the protocol and port preferences
+// tracker operators publish in DNS TXT records (BEP 34) are honored, including
+// records asking not to be contacted. It is enabled by default.
+func WithDNSTrackerPreferences(enabled bool) Option {
+	return func(s *Session) {
+		s.dnsTrackerPrefs = enabled
+	}
+}
+
+// WithAnnounceToAllTrackers makes Announce contact all of a torrent's trackers
+// at once, whatever protocol each speaks, and merge the peers they return,
+// instead of stopping at the first tracker that answers. It is disabled by default.
+func WithAnnounceToAllTrackers(enabled bool) Option {
+	return func(s *Session) {
+		s.announceToAll = enabled
+	}
+}
@@ -0,0 +1,71 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/netip"
+	"slices"
+
+	"github.com/ayu-ch/bittorrent-client/torrent"
+)
+
+// KnownPeers returns the peers from the most recent successful announce of t,
+// which may come from an earlier run when the session has a state directory,
+// so that connecting can start before the first announce completes.
+func (s *Session) KnownPeers(t *torrent.Torrent) []torrent.Peer {
+	s.peerCacheMu.Lock()
+	defer s.peerCacheMu.Unlock()
+	var peers []torrent.Peer
+	for _, addr := range s.peerCache[fmt.Sprintf("%x", t.InfoHash)] {
+		ap, err := netip.ParseAddrPort(addr)
+		if err != nil {
+			continue
+		}
+		peers = append(peers, torrent.Peer{IP: net.IP(ap.Addr().Unmap().AsSlice()), Port: ap.Port()})
+	}
+	return peers
+}
+
+// rememberPeers replaces the known peers of t with those in resp and saves
+// them to the peer cache file, if there is one.
+func (s *Session) rememberPeers(t *torrent.Torrent, resp *torrent.TrackerResponse) {
+	if len(resp.Peers) == 0 {
+		return
+	}
+	addrs := make([]string, 0, min(len(resp.Peers), torrent.MaxTrackerPeers))
+	for _, peer := range resp.Peers[:cap(addrs)] {
+		addrs = append(addrs, peer.String())
+	}
+	// Trackers return peers in random order; sorting lets an unchanged
+	// peer set be recognised and the file left alone.
+	slices.Sort(addrs)
+	addrs = slices.Compact(addrs)
+
+	s.peerCacheMu.Lock()
+	defer s.peerCacheMu.Unlock()
+	key := fmt.Sprintf("%x", t.InfoHash)
+	if slices.Equal(s.peerCache[key], addrs) {
+		return
+	}
+	s.peerCache[key] = addrs
+	if s.peerCacheFile == "" {
+		return
+	}
+	if err := writeStateFile(s.peerCacheFile, s.peerCache); err != nil {
+		s.logger.Printf("failed to save peer cache: %v", err)
+	}
+}
+
+// loadPeerCache reads the peer cache file, if there is one yet.
+func (s *Session) loadPeerCache() error {
+	err := readStateFile(s.peerCacheFile, &s.peerCache)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read peer cache %s: %w", s.peerCacheFile, err)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package session
+
+import (
+	"errors"
+	"time"
+
+	"github.com/ayu-ch/bittorrent-client/torrent"
+)
+
+var (
+	// ErrNotStarted is returned when announcing a torrent before its StartAt time.
+	ErrNotStarted = errors.New("torrent is scheduled to start later")
+	// ErrExpired is returned when announcing a torrent after its StopAt time,
+	// until it is added again.
+	ErrExpired = errors.New("torrent has expired")
+)
+
+// maxExpired is how many expired torrents are remembered; past it, the ones
+// that stopped longest ago are forgotten and announcing them fails as for any
+// unknown torrent.
+const maxExpired = 1024
+
+// RemoveTorrent removes the torrent with the given info hash from the session
+// and reports whether it was there.
+func (s *Session) RemoveTorrent(infoHash [20]byte) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.torrents[infoHash]
+	delete(s.torrents, infoHash)
+	return ok
+}
+
+// schedule returns the start and stop times t was added with; either is zero if unset.
+func (s *Session) schedule(t *torrent.Torrent) (start, stop time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if m, ok := s.torrents[t.InfoHash]; ok {
+		return m.opts.StartAt, m.opts.StopAt
+	}
+	return time.Time{}, time.Time{}
+}
+
+// untilStart returns how long until t is scheduled to start, or zero if it already may.
+func (s *Session) untilStart(t *torrent.Torrent) time.Duration {
+	start, _ := s.schedule(t)
+	if start.IsZero() {
+		return 0
+	}
+	return max(time.Until(start), 0)
+}
+
+// checkSchedule returns an error if t may not be announced now.
+func (s *Session) checkSchedule(t *torrent.Torrent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.expireLocked(now)
+	if _, ok := s.expired[t.InfoHash]; ok {
+		return ErrExpired
+	}
+	if m, ok := s.torrents[t.InfoHash]; ok && !m.opts.StartAt.IsZero() && now.Before(m.opts.StartAt) {
+		return ErrNotStarted
+	}
+	return nil
+}
+
+// expireLocked removes the torrents whose stop time has passed, remembering
+// them so that announcing them keeps failing. s.mu must be held.
+func (s *Session) expireLocked(now time.Time) {
+	for hash, m := range s.torrents {
+		stop := m.opts.StopAt
+		if stop.IsZero() || now.Before(stop) {
+			continue
+		}
+		delete(s.torrents, hash)
+		s.expired[hash] = stop
+		s.logger.Printf("torrent %x expired at %s, removed it", hash, stop.Format(time.RFC3339))
+	}
+	for len(s.expired) > maxExpired {
+		var oldest [20]byte
+		var oldestStop time.Time
+		for hash, stop := range s.expired {
+			if oldestStop.IsZero() || stop.Before(oldestStop) {
+				oldest, oldestStop = hash, stop
+			}
+		}
+		delete(s.expired, oldest)
+	}
+}
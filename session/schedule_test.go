@@ -0,0 +1,73 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStopAtEnforcedByTorrents(t *testing.T) {
+	s, err := NewSession()
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	kept := indexedTorrent(1, "kept")
+	expired := indexedTorrent(2, "expired")
+	s.AddTorrent(kept, &AddTorrentOptions{StopAt: time.Now().Add(time.Hour)})
+	s.AddTorrent(expired, &AddTorrentOptions{StopAt: time.Now().Add(-time.Second)})
+
+	torrents := s.Torrents()
+	if len(torrents) != 1 || torrents[0] != kept {
+		t.Fatalf("Torrents() = %v, want only the torrent that hasn't expired", torrents)
+	}
+	// The torrent is gone from the session, but announcing it still fails.
+	if _, err := s.Announce(context.Background(), expired); !errors.Is(err, ErrExpired) {
+		t.Errorf("Announce of an expired torrent = %v, want ErrExpired", err)
+	}
+
+	s.AddTorrent(expired, nil)
+	if len(s.Torrents()) != 2 {
+		t.Errorf("an expired torrent added again isn't listed")
+	}
+}
+
+func TestStartAt(t *testing.T) {
+	s, err := NewSession()
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	later := indexedTorrent(1, "later")
+	s.AddTorrent(later, &AddTorrentOptions{StartAt: time.Now().Add(time.Hour)})
+	if _, err := s.Announce(context.Background(), later); !errors.Is(err, ErrNotStarted) {
+		t.Errorf("Announce before StartAt = %v, want ErrNotStarted", err)
+	}
+	if d := s.untilStart(later); d <= 59*time.Minute {
+		t.Errorf("untilStart = %v, want about an hour", d)
+	}
+}
+
+func TestExpiredBounded(t *testing.T) {
+	s, err := NewSession()
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	base := time.Now().Add(-time.Hour)
+	for i := range maxExpired {
+		s.expired[[20]byte{byte(i), byte(i >> 8), 1}] = base.Add(time.Duration(i) * time.Second)
+	}
+	oldest := [20]byte{0, 0, 1}
+
+	latest := indexedTorrent(2, "latest")
+	s.AddTorrent(latest, &AddTorrentOptions{StopAt: time.Now().Add(-time.Second)})
+	s.Torrents()
+	if len(s.expired) != maxExpired {
+		t.Errorf("%d expired torrents remembered, want %d", len(s.expired), maxExpired)
+	}
+	if _, ok := s.expired[oldest]; ok {
+		t.Error("the torrent that stopped longest ago is still remembered")
+	}
+	if _, err := s.Announce(context.Background(), latest); !errors.Is(err, ErrExpired) {
+		t.Errorf("Announce of the latest expired torrent = %v, want ErrExpired", err)
+	}
+}
@@ -0,0 +1,360 @@
+package session
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/ayu-ch/bittorrent-client/torrent"
+)
+
+// DefaultListenPort is the port reported to trackers when none is configured.
+const DefaultListenPort = 6881
+
+// Session holds the configuration and torrents shared by a running client.
+type Session struct {
+	peerID     [20]byte
+	listenPort uint16
+	logger     *log.Logger
+	dialer     torrent.Dialer
+	dohURL     string
+	resolver   *net.Resolver
+
+	extraTrackers []string
+	trackerList   *trackerList
+
+	httpTracker  torrent.TrackerClient
+	httpTracker4 torrent.TrackerClient
+	httpTracker6 torrent.TrackerClient
+	dualStack    bool
+	// announceToAll makes Announce contact every tracker at once.
+	announceToAll bool
+
+	dnsTrackerPrefs bool
+	prefMu          sync.Mutex
+	trackerPrefs    map[string]trackerPreferenceEntry
+
+	stateDir string
+	// stateReadOnly is set by WithReadOnlyStateDir.
+	stateReadOnly bool
+	// stateLock is the locked lock file of the state directory.
+	stateLock    *os.File
+	healthFile   string
+	healthMu     sync.Mutex
+	healthSaveMu sync.Mutex
+	health       map[string]TrackerHealth
+	// protocols is the announce history per tracker URL scheme; it isn't persisted.
+	protocols map[string]TrackerHealth
+
+	peerCacheFile string
+	peerCacheMu   sync.Mutex
+	// peerCache maps hex info hashes to the peers their last announce returned.
+	peerCache map[string][]string
+
+	indexFile string
+	indexMu   sync.Mutex
+	// index maps hex info hashes to every torrent ever added with the state directory.
+	index map[string]IndexEntry
+
+	announceSpread time.Duration
+	hostSlots      int
+	hostMu         sync.Mutex
+	hostSems       map[string]chan struct{}
+
+	suspendMu sync.Mutex
+	// resumed is closed by Resume; it is nil while the session isn't suspended.
+	resumed chan struct{}
+
+	mu       sync.Mutex
+	torrents map[[20]byte]*managedTorrent
+	// expired holds the stop times of torrents removed for having expired.
+	expired map[[20]byte]time.Time
+	added   int
+	// externalIP4 and externalIP6 are our addresses as last reported by trackers.
+	externalIP4 net.IP
+	externalIP6 net.IP
+}
+
+// managedTorrent is a torrent in the session along with the options it was added with.
+type managedTorrent struct {
+	t    *torrent.Torrent
+	opts AddTorrentOptions
+	// seq orders torrents by when they were added.
+	seq int
+	// announced holds the trackers that have listed us in the torrent's
+	// swarm since the last stopped announce.
+	announced map[string]bool
+}
+
+// NewSession creates a session configured by opts.
+func NewSession(opts ...Option) (*Session, error) {
+	s := &Session{
+		listenPort:      DefaultListenPort,
+		logger:          log.New(io.Discard, "", 0),
+		dualStack:       true,
+		dnsTrackerPrefs: true,
+		trackerPrefs:    make(map[string]trackerPreferenceEntry),
+		health:          make(map[string]TrackerHealth),
+		protocols:       make(map[string]TrackerHealth),
+		peerCache:       make(map[string][]string),
+		index:           make(map[string]IndexEntry),
+		announceSpread:  DefaultAnnounceSpread,
+		hostSlots:       DefaultTrackerHostConcurrency,
+		hostSems:        make(map[string]chan struct{}),
+		torrents:        make(map[[20]byte]*managedTorrent),
+		expired:         make(map[[20]byte]time.Time),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if _, err := rand.Read(s.peerID[:]); err != nil {
+		return nil, fmt.Errorf("failed to generate peer ID: %w", err)
+	}
+	if s.dohURL != "" {
+		s.useDoH()
+	}
+	if s.stateDir != "" && !s.stateReadOnly {
+		if err := os.MkdirAll(s.stateDir, 0o700); err != nil {
+			return nil, fmt.Errorf("failed to create state directory: %w", err)
+		}
+		lock, err := lockStateDir(s.stateDir)
+		switch {
+		case errors.Is(err, errors.ErrUnsupported):
+			s.logger.Printf("warning: state directory %s can't be locked on this system; don't share it between sessions", s.stateDir)
+		case err != nil:
+			return nil, fmt.Errorf("failed to lock state directory %s: %w", s.stateDir, err)
+		}
+		s.stateLock = lock
+	}
+	if s.stateDir != "" {
+		if s.healthFile == "" {
+			s.healthFile = filepath.Join(s.stateDir, trackerHealthFileName)
+		}
+		s.peerCacheFile = filepath.Join(s.stateDir, peerCacheFileName)
+		if err := s.loadPeerCache(); err != nil {
+			s.logger.Print(err)
+		}
+		s.indexFile = filepath.Join(s.stateDir, indexFileName)
+		if err := s.loadIndex(); err != nil {
+			s.logger.Print(err)
+		}
+	}
+	if s.healthFile != "" {
+		// Stale or damaged history only costs tracker ordering, so start without it.
+		if err := s.loadTrackerHealth(); err != nil {
+			s.logger.Print(err)
+		}
+	}
+	if s.stateReadOnly {
+		s.healthFile, s.peerCacheFile, s.indexFile = "", "", ""
+	}
+	s.httpTracker = torrent.NewHTTPTracker(s.dialer)
+	// Announcing per address family only makes sense when we resolve and
+	// dial ourselves; a proxy dialer decides the route on its own, and
+	// looking up TXT records would leak tracker names around it.
+	if _, ok := s.dialer.(*net.Dialer); s.dialer != nil && !ok {
+		s.dualStack = false
+		s.dnsTrackerPrefs = false
+	}
+	if s.dualStack {
+		s.httpTracker4 = torrent.NewHTTPTrackerForNetwork(s.dialer, "tcp4")
+		s.httpTracker6 = torrent.NewHTTPTrackerForNetwork(s.dialer, "tcp6")
+	}
+	if s.trackerList != nil {
+		s.trackerList.client = s.httpClient()
+	}
+	return s, nil
+}
+
+// useDoH resolves tracker names through the configured DNS-over-HTTPS server
+// by giving the session's dialer a DoH resolver. Proxy dialers resolve names
+// on their own and are left alone.
+func (s *Session) useDoH() {
+	var dialer net.Dialer
+	switch d := s.dialer.(type) {
+	case nil:
+		dialer = net.Dialer{Timeout: 15 * time.Second, KeepAlive: 30 * time.Second}
+	case *net.Dialer:
+		dialer = *d
+	default:
+		s.logger.Printf("not using DNS-over-HTTPS: the configured dialer resolves names itself")
+		return
+	}
+	s.resolver = torrent.NewDoHResolver(s.dohURL, nil)
+	dialer.Resolver = s.resolver
+	s.dialer = &dialer
+}
+
+// PeerID returns the peer ID the session announces with.
+func (s *Session) PeerID() [20]byte {
+	return s.peerID
+}
+
+// ListenPort returns the port the session reports to trackers.
+func (s *Session) ListenPort() uint16 {
+	return s.listenPort
+}
+
+// Close releases the session's state directory so another session can use
+// it. The session must not be used afterwards.
+func (s *Session) Close() error {
+	if s.stateLock == nil {
+		return nil
+	}
+	err := s.stateLock.Close()
+	s.stateLock = nil
+	return err
+}
+
+// AddTorrent adds t to the session and returns the torrent the session now
+// manages. Non-private torrents get the session's extra trackers. opts may be
+// nil to use the defaults.
+//
+// If a torrent with the same info hash was already added, t's trackers are
+// merged into it and the existing torrent is returned; opts is ignored then.
+func (s *Session) AddTorrent(t *torrent.Torrent, opts *AddTorrentOptions) (*torrent.Torrent, error) {
+	s.mu.Lock()
+	// An expired torrent being added again starts over with the new options.
+	s.expireLocked(time.Now())
+	if existing, ok := s.torrents[t.InfoHash]; ok {
+		existing.t.AddTrackers(t.Trackers())
+		s.mu.Unlock()
+		s.logger.Printf("torrent %x already added, merged its trackers", t.InfoHash)
+		return existing.t, nil
+	}
+	s.mu.Unlock()
+
+	var extra []string
+	if !t.Info.Private {
+		extra = s.publicTrackers()
+	}
+
+	s.mu.Lock()
+	// Another call may have added the same torrent while the tracker list was fetched.
+	if existing, ok := s.torrents[t.InfoHash]; ok {
+		existing.t.AddTrackers(t.Trackers())
+		s.mu.Unlock()
+		return existing.t, nil
+	}
+	t.AddTrackers(extra)
+	delete(s.expired, t.InfoHash)
+	s.added++
+	m := &managedTorrent{t: t, seq: s.added}
+	if opts != nil {
+		m.opts = *opts
+	}
+	s.torrents[t.InfoHash] = m
+	s.mu.Unlock()
+
+	s.indexTorrent(t, m.opts.Labels)
+	return t, nil
+}
+
+// publicTrackers returns the configured extra trackers followed by the remote tracker list.
+func (s *Session) publicTrackers() []string {
+	trackers := append([]string(nil), s.extraTrackers...)
+	if s.trackerList != nil {
+		remote, err := s.trackerList.get()
+		if err != nil {
+			s.logger.Printf("tracker list %s: %v", s.trackerList.url, err)
+		}
+		trackers = append(trackers, remote...)
+	}
+	return trackers
+}
+
+// DialPeer connects to the peer at addr through the session's dialer, so
+// peer connections take the same route as tracker traffic, such as a proxy.
+// Without one, names are resolved with the session's resolver and both
+// address families are raced (Happy Eyeballs). While the session is
+// suspended, DialPeer waits for Resume or for ctx to be cancelled.
+func (s *Session) DialPeer(ctx context.Context, addr string) (net.Conn, error) {
+	if err := s.waitResumed(ctx); err != nil {
+		return nil, err
+	}
+	if s.dialer != nil {
+		return s.dialer.DialContext(ctx, "tcp", addr)
+	}
+	d := net.Dialer{Resolver: s.resolver, FallbackDelay: 300 * time.Millisecond}
+	return d.DialContext(ctx, "tcp", addr)
+}
+
+// httpClient returns an HTTP client for non-tracker requests that dials through the session's dialer.
+func (s *Session) httpClient() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if s.dialer != nil {
+		transport.DialContext = s.dialer.DialContext
+	}
+	return &http.Client{Transport: transport, Timeout: 30 * time.Second}
+}
+
+// Torrents returns the torrents in the session in the order they were added.
+// Torrents past their stop time are removed first.
+func (s *Session) Torrents() []*torrent.Torrent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expireLocked(time.Now())
+	managed := make([]*managedTorrent, 0, len(s.torrents))
+	for _, m := range s.torrents {
+		managed = append(managed, m)
+	}
+	slices.SortFunc(managed, func(a, b *managedTorrent) int {
+		return a.seq - b.seq
+	})
+
+	torrents := make([]*torrent.Torrent, len(managed))
+	for i, m := range managed {
+		torrents[i] = m.t
+	}
+	return torrents
+}
+
+// ExternalIPs returns our IPv4 and IPv6 addresses as last reported by
+// trackers (BEP 24). Either is nil until a tracker has reported it.
+func (s *Session) ExternalIPs() (ipv4, ipv6 net.IP) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.externalIP4, s.externalIP6
+}
+
+// noteExternalIP records an external address reported by a tracker.
+func (s *Session) noteExternalIP(ip net.IP) {
+	if ip == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ip4 := ip.To4(); ip4 != nil {
+		if !ip4.Equal(s.externalIP4) {
+			s.logger.Printf("external IPv4 address is %s", ip4)
+		}
+		s.externalIP4 = ip4
+	} else {
+		if !ip.Equal(s.externalIP6) {
+			s.logger.Printf("external IPv6 address is %s", ip)
+		}
+		s.externalIP6 = ip
+	}
+}
+
+// withoutSelf removes our own address, as trackers see it, from peers.
+func (s *Session) withoutSelf(peers []torrent.Peer, port uint16) []torrent.Peer {
+	ipv4, ipv6 := s.ExternalIPs()
+	if ipv4 == nil && ipv6 == nil {
+		return peers
+	}
+	return slices.DeleteFunc(peers, func(p torrent.Peer) bool {
+		return p.Port == port && (p.IP.Equal(ipv4) || p.IP.Equal(ipv6))
+	})
+}
@@ -0,0 +1,172 @@
+package session
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// appDir is the name of the client's directory inside the OS state location.
+const appDir = "bittorrent-client"
+
+const (
+	// trackerHealthFileName is the name of the tracker health file in the state directory.
+	trackerHealthFileName = "tracker-health.json"
+	// peerCacheFileName is the name of the file in the state directory
+	// holding the peers each torrent's last announce returned.
+	peerCacheFileName = "peers.json"
+	// indexFileName is the name of the torrent index log in the state directory.
+	indexFileName = "index.jsonl"
+	// lockFileName is the name of the file in the state directory that a
+	// session holds locked while it uses the directory.
+	lockFileName = "lock"
+)
+
+// ErrStateDirLocked is returned by NewSession when another session, in this
+// process or another, is using the state directory. The error names the
+// process holding the lock when it is known.
+var ErrStateDirLocked = errors.New("another session holds the lock")
+
+// DefaultStateDir returns where the client keeps its state by default:
+// $XDG_STATE_HOME/bittorrent-client, falling back to
+// ~/.local/state/bittorrent-client, on Unix systems, and the user
+// configuration directory on Windows and macOS.
+func DefaultStateDir() (string, error) {
+	switch runtime.GOOS {
+	case "windows", "darwin", "ios", "plan9":
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(dir, appDir), nil
+	}
+
+	if dir := os.Getenv("XDG_STATE_HOME"); filepath.IsAbs(dir) {
+		return filepath.Join(dir, appDir), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	if home == "" {
+		return "", errors.New("neither $XDG_STATE_HOME nor $HOME are defined")
+	}
+	return filepath.Join(home, ".local", "state", appDir), nil
+}
+
+// writeFileAtomic replaces the file name with data atomically, so a crash
+// never leaves a truncated file behind.
+func writeFileAtomic(name string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), name); err != nil {
+		return err
+	}
+	// The rename is only durable once the directory entry is on disk too.
+	return syncDir(filepath.Dir(name))
+}
+
+// stateFile is the on-disk form of a state file: its JSON content and the
+// SHA-256 checksum of the compacted content.
+type stateFile struct {
+	SHA256 string          `json:"sha256"`
+	Data   json.RawMessage `json:"data"`
+}
+
+// writeStateFile replaces the state file name with v encoded as JSON, along
+// with its checksum.
+func writeStateFile(name string, v any) error {
+	data, err := encodeStateRecord(v)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(name, data)
+}
+
+// readStateFile decodes the state file name into v after verifying its
+// checksum.
+func readStateFile(name string, v any) error {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	return decodeStateRecord(data, v)
+}
+
+// encodeStateRecord encodes v as JSON in a stateFile with its checksum.
+func encodeStateRecord(v any) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	return json.Marshal(stateFile{SHA256: hex.EncodeToString(sum[:]), Data: data})
+}
+
+// decodeStateRecord verifies the checksum of a record written by
+// encodeStateRecord and decodes its content into v. A record without a
+// checksum is corrupt.
+func decodeStateRecord(data []byte, v any) error {
+	var file stateFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return err
+	}
+	if file.SHA256 == "" {
+		return errors.New("missing checksum")
+	}
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, file.Data); err != nil {
+		return err
+	}
+	if sum := sha256.Sum256(compact.Bytes()); hex.EncodeToString(sum[:]) != file.SHA256 {
+		return errors.New("checksum mismatch")
+	}
+	return json.Unmarshal(file.Data, v)
+}
+
+// writeLockOwner records the current process as the holder of the locked
+// lock file f.
+func writeLockOwner(f *os.File) error {
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	_, err := f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	return err
+}
+
+// lockedError returns the error for a lock file f that another session
+// holds, naming the process written into it by writeLockOwner.
+func lockedError(f *os.File) error {
+	data, err := io.ReadAll(io.NewSectionReader(f, 0, 32))
+	if err != nil {
+		return ErrStateDirLocked
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return ErrStateDirLocked
+	}
+	return fmt.Errorf("%w (process %d)", ErrStateDirLocked, pid)
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package session
+
+// syncDir does nothing on systems where a directory can't be opened for
+// syncing.
+func syncDir(dir string) error {
+	return nil
+}
@@ -0,0 +1,77 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStateFileRoundTrip(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "state.json")
+	want := map[string][]string{"ab": {"10.0.0.1:6881", "<&>"}}
+	if err := writeStateFile(name, want); err != nil {
+		t.Fatalf("writeStateFile: %v", err)
+	}
+	var got map[string][]string
+	if err := readStateFile(name, &got); err != nil {
+		t.Fatalf("readStateFile: %v", err)
+	}
+	if len(got["ab"]) != 2 || got["ab"][1] != "<&>" {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestStateFileChecksumMismatch(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "state.json")
+	if err := writeStateFile(name, map[string]int{"announces": 1}); err != nil {
+		t.Fatalf("writeStateFile: %v", err)
+	}
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name, []byte(strings.Replace(string(data), ":1}", ":2}", 1)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]int
+	if err := readStateFile(name, &got); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("readStateFile of a modified file = %v, want checksum mismatch", err)
+	}
+}
+
+func TestStateFileWithoutChecksum(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "state.json")
+	if err := os.WriteFile(name, []byte(`{"tracker.example": {"announces": 3}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]TrackerHealth
+	if err := readStateFile(name, &got); err == nil || !strings.Contains(err.Error(), "missing checksum") {
+		t.Errorf("readStateFile of a file without a checksum = %v, want missing checksum", err)
+	}
+}
+
+func TestStateDirLock(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewSession(WithStateDir(dir))
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	_, err = NewSession(WithStateDir(dir))
+	if !errors.Is(err, ErrStateDirLocked) {
+		t.Fatalf("second NewSession = %v, want ErrStateDirLocked", err)
+	}
+	if pid := fmt.Sprintf("process %d", os.Getpid()); !strings.Contains(err.Error(), pid) {
+		t.Errorf("second NewSession = %v, want the error to name %s", err, pid)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	s, err = NewSession(WithStateDir(dir))
+	if err != nil {
+		t.Fatalf("NewSession after Close: %v", err)
+	}
+	s.Close()
+}
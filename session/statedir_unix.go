@@ -0,0 +1,18 @@
+//go:build unix
+
+package session
+
+import "os"
+
+// syncDir flushes the directory dir to disk, making renames in it durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	err = d.Sync()
+	if cerr := d.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
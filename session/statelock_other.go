@@ -0,0 +1,14 @@
+//go:build !unix && !windows
+
+package session
+
+import (
+	"errors"
+	"os"
+)
+
+// lockStateDir fails with errors.ErrUnsupported: these systems have no file
+// locks to guard the state directory with.
+func lockStateDir(dir string) (*os.File, error) {
+	return nil, errors.ErrUnsupported
+}
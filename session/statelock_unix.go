@@ -0,0 +1,32 @@
+//go:build unix
+
+package session
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// lockStateDir takes an exclusive lock on the lock file in dir and writes
+// the process ID into it. The lock is held until the returned file is closed
+// or the process exits.
+func lockStateDir(dir string) (*os.File, error) {
+	f, err := os.OpenFile(filepath.Join(dir, lockFileName), os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			err = lockedError(f)
+		}
+		f.Close()
+		return nil, err
+	}
+	if err := writeLockOwner(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
@@ -0,0 +1,45 @@
+//go:build windows
+
+package session
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+var procLockFileEx = syscall.NewLazyDLL("kernel32.dll").NewProc("LockFileEx")
+
+const (
+	lockfileFailImmediately = 0x1
+	lockfileExclusiveLock   = 0x2
+
+	errorLockViolation syscall.Errno = 33
+)
+
+// lockStateDir takes an exclusive lock on the lock file in dir and writes
+// the process ID into it. The lock is held until the returned file is closed
+// or the process exits.
+func lockStateDir(dir string) (*os.File, error) {
+	f, err := os.OpenFile(filepath.Join(dir, lockFileName), os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	// Windows locks are mandatory, so lock a byte at 4 GiB, well past the
+	// process ID, which other sessions must be able to read.
+	ol := syscall.Overlapped{OffsetHigh: 1}
+	r, _, err := procLockFileEx.Call(f.Fd(), lockfileExclusiveLock|lockfileFailImmediately, 0, 1, 0, uintptr(unsafe.Pointer(&ol)))
+	if r == 0 {
+		if err == errorLockViolation {
+			err = lockedError(f)
+		}
+		f.Close()
+		return nil, err
+	}
+	if err := writeLockOwner(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
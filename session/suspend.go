@@ -0,0 +1,113 @@
+package session
+
+import (
+	"context"
+	"sync"
+
+	"github.com/ayu-ch/bittorrent-client/torrent"
+)
+
+// Suspend parks the session's network activity without removing any
+// torrents: announces, scrapes and peer connections that haven't started wait
+// until Resume is called, while those already in flight finish normally.
+// Trackers that torrents were announced to get a stopped announce, so they
+// stop handing out our address; Suspend returns once they have all answered
+// or ctx is cancelled. Suspending a suspended session does nothing.
+func (s *Session) Suspend(ctx context.Context) {
+	s.suspendMu.Lock()
+	if s.resumed != nil {
+		s.suspendMu.Unlock()
+		return
+	}
+	s.resumed = make(chan struct{})
+	s.suspendMu.Unlock()
+	s.logger.Printf("session suspended")
+	s.announceStopped(ctx)
+}
+
+// Resume restarts network activity parked by Suspend.
+func (s *Session) Resume() {
+	s.suspendMu.Lock()
+	defer s.suspendMu.Unlock()
+	if s.resumed != nil {
+		close(s.resumed)
+		s.resumed = nil
+		s.logger.Printf("session resumed")
+	}
+}
+
+// Suspended reports whether the session is suspended.
+func (s *Session) Suspended() bool {
+	s.suspendMu.Lock()
+	defer s.suspendMu.Unlock()
+	return s.resumed != nil
+}
+
+// waitResumed blocks while the session is suspended, returning ctx's error if
+// it is cancelled first.
+func (s *Session) waitResumed(ctx context.Context) error {
+	s.suspendMu.Lock()
+	resumed := s.resumed
+	s.suspendMu.Unlock()
+	if resumed == nil {
+		return nil
+	}
+	select {
+	case <-resumed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// noteAnnounced records that tracker has listed us in t's swarm.
+func (s *Session) noteAnnounced(t *torrent.Torrent, tracker string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.torrents[t.InfoHash]
+	if !ok {
+		return
+	}
+	if m.announced == nil {
+		m.announced = make(map[string]bool)
+	}
+	m.announced[tracker] = true
+}
+
+// announceStopped sends a stopped announce to every tracker that has listed
+// us in a swarm, all at once, and waits for them or for ctx.
+func (s *Session) announceStopped(ctx context.Context) {
+	type stop struct {
+		t       *torrent.Torrent
+		tracker string
+	}
+	var stops []stop
+	s.mu.Lock()
+	for _, m := range s.torrents {
+		for tracker := range m.announced {
+			stops = append(stops, stop{m.t, tracker})
+		}
+		m.announced = nil
+	}
+	s.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, st := range stops {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := s.announceEvent(st.t, st.tracker, "stopped"); err != nil {
+				s.logger.Printf("stopped announce to %s failed: %v", st.tracker, err)
+			}
+		}()
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+}
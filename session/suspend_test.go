@@ -0,0 +1,110 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ayu-ch/bittorrent-client/torrent"
+)
+
+// eventTracker is an HTTP tracker that records the event of every announce.
+type eventTracker struct {
+	*httptest.Server
+	mu     sync.Mutex
+	events []string
+}
+
+func newEventTracker(t *testing.T) *eventTracker {
+	et := &eventTracker{}
+	et.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		et.mu.Lock()
+		et.events = append(et.events, r.URL.Query().Get("event"))
+		et.mu.Unlock()
+		w.Write([]byte("d8:intervali1800e5:peers0:e"))
+	}))
+	t.Cleanup(et.Close)
+	return et
+}
+
+func (et *eventTracker) seen() []string {
+	et.mu.Lock()
+	defer et.mu.Unlock()
+	return slices.Clone(et.events)
+}
+
+// newTestSession returns a session that announces over plain HTTP without DNS lookups.
+func newTestSession(t *testing.T) *Session {
+	s, err := NewSession(WithDualStackAnnounce(false), WithDNSTrackerPreferences(false))
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	return s
+}
+
+func TestSuspendAnnouncesStopped(t *testing.T) {
+	tracker := newEventTracker(t)
+	s := newTestSession(t)
+	tor := &torrent.Torrent{Announce: tracker.URL + "/announce", InfoHash: [20]byte{1}, Info: torrent.Info{Name: "a", Length: 100}}
+	if _, err := s.AddTorrent(tor, nil); err != nil {
+		t.Fatalf("AddTorrent: %v", err)
+	}
+	// A torrent that was never announced gets no stopped announce.
+	s.AddTorrent(&torrent.Torrent{Announce: tracker.URL + "/announce", InfoHash: [20]byte{2}, Info: torrent.Info{Name: "b", Length: 100}}, nil)
+	if _, err := s.Announce(context.Background(), tor); err != nil {
+		t.Fatalf("Announce: %v", err)
+	}
+
+	s.Suspend(context.Background())
+	if got, want := tracker.seen(), []string{"", "stopped"}; !slices.Equal(got, want) {
+		t.Errorf("tracker saw events %q, want %q", got, want)
+	}
+	// Suspending again sends nothing.
+	s.Suspend(context.Background())
+	if got := tracker.seen(); len(got) != 2 {
+		t.Errorf("second Suspend sent more announces: %q", got)
+	}
+}
+
+func TestSuspendedCallsWait(t *testing.T) {
+	tracker := newEventTracker(t)
+	s := newTestSession(t)
+	tor := &torrent.Torrent{Announce: tracker.URL + "/announce", InfoHash: [20]byte{1}, Info: torrent.Info{Name: "a", Length: 100}}
+	s.AddTorrent(tor, nil)
+	s.Suspend(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := s.AnnounceTo(ctx, tor, tor.Announce); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("AnnounceTo while suspended = %v, want DeadlineExceeded", err)
+	}
+	if _, err := s.Scrape(ctx, tor, tor.Announce); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Scrape while suspended = %v, want DeadlineExceeded", err)
+	}
+	if _, err := s.DialPeer(ctx, tracker.Listener.Addr().String()); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("DialPeer while suspended = %v, want DeadlineExceeded", err)
+	}
+	if got := tracker.seen(); len(got) != 0 {
+		t.Errorf("tracker was contacted while suspended: %q", got)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := s.AnnounceTo(context.Background(), tor, tor.Announce)
+		done <- err
+	}()
+	s.Resume()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("AnnounceTo after Resume: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("AnnounceTo didn't proceed after Resume")
+	}
+}
@@ -0,0 +1,137 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/ayu-ch/bittorrent-client/torrent"
+)
+
+// TrackerHealth is the announce history of a tracker host.
+type TrackerHealth struct {
+	Announces int `json:"announces"`
+	Failures  int `json:"failures"`
+	// Peers is the total number of peers the host returned.
+	Peers int `json:"peers"`
+}
+
+// score estimates how many peers an announce to the host yields. Failed
+// announces count as zero peers, and the smoothing puts hosts without
+// history between ones that deliver peers and ones that keep failing.
+func (h TrackerHealth) score() float64 {
+	return float64(h.Peers+1) / float64(h.Announces+2)
+}
+
+// trackerHost returns the key tracker health is recorded under.
+func trackerHost(tracker string) string {
+	u, err := url.Parse(tracker)
+	if err != nil {
+		return tracker
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// TrackerHealth returns the announce history of every tracker host the session has announced to.
+func (s *Session) TrackerHealth() map[string]TrackerHealth {
+	s.healthMu.Lock()
+	defer s.healthMu.Unlock()
+	health := make(map[string]TrackerHealth, len(s.health))
+	for host, h := range s.health {
+		health[host] = h
+	}
+	return health
+}
+
+// ProtocolStats returns the announce history of the session per tracker
+// protocol, keyed by URL scheme such as "http" or "udp".
+func (s *Session) ProtocolStats() map[string]TrackerHealth {
+	s.healthMu.Lock()
+	defer s.healthMu.Unlock()
+	stats := make(map[string]TrackerHealth, len(s.protocols))
+	for scheme, h := range s.protocols {
+		stats[scheme] = h
+	}
+	return stats
+}
+
+// trackerScheme returns the key protocol stats are recorded under.
+func trackerScheme(tracker string) string {
+	u, err := url.Parse(tracker)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Scheme)
+}
+
+// recordAnnounce updates the health of tracker's host and protocol after an announce.
+func (s *Session) recordAnnounce(tracker string, peers int, err error) {
+	s.healthMu.Lock()
+	defer s.healthMu.Unlock()
+	s.health[trackerHost(tracker)] = s.health[trackerHost(tracker)].record(peers, err)
+	scheme := trackerScheme(tracker)
+	s.protocols[scheme] = s.protocols[scheme].record(peers, err)
+}
+
+// record returns h updated with the outcome of one announce.
+func (h TrackerHealth) record(peers int, err error) TrackerHealth {
+	h.Announces++
+	if err != nil {
+		h.Failures++
+	} else {
+		h.Peers += peers
+	}
+	return h
+}
+
+// orderTrackers returns t's trackers tier by tier, each tier sorted so the
+// hosts that have delivered the most peers are announced to first. Tiers keep
+// their order, so a lower tier is still only used when a higher one fails.
+func (s *Session) orderTrackers(t *torrent.Torrent) []string {
+	s.mu.Lock()
+	tiers := t.Tiers()
+	s.mu.Unlock()
+
+	s.healthMu.Lock()
+	defer s.healthMu.Unlock()
+	var trackers []string
+	for _, tier := range tiers {
+		slices.SortStableFunc(tier, func(a, b string) int {
+			sa, sb := s.health[trackerHost(a)].score(), s.health[trackerHost(b)].score()
+			switch {
+			case sa > sb:
+				return -1
+			case sa < sb:
+				return 1
+			}
+			return 0
+		})
+		trackers = append(trackers, tier...)
+	}
+	return trackers
+}
+
+// loadTrackerHealth reads the health file, if there is one yet.
+func (s *Session) loadTrackerHealth() error {
+	err := readStateFile(s.healthFile, &s.health)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read tracker health %s: %w", s.healthFile, err)
+	}
+	return nil
+}
+
+// saveTrackerHealth writes the health file.
+func (s *Session) saveTrackerHealth() error {
+	s.healthSaveMu.Lock()
+	defer s.healthSaveMu.Unlock()
+	if err := writeStateFile(s.healthFile, s.TrackerHealth()); err != nil {
+		return fmt.Errorf("failed to save tracker health: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package session
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ayu-ch/bittorrent-client/torrent"
+)
+
+// DefaultTrackerListRefresh is how often a remote public tracker list is fetched again.
+const DefaultTrackerListRefresh = 24 * time.Hour
+
+// trackerListRetry is how long to wait after a failed fetch before trying again.
+const trackerListRetry = 5 * time.Minute
+
+// maxTrackerListSize caps how much of a remote tracker list is read.
+const maxTrackerListSize = 1 << 20
+
+// trackerList is a remote list of public trackers, fetched on demand and kept until it goes stale.
+type trackerList struct {
+	url     string
+	refresh time.Duration
+	client  *http.Client
+
+	mu       sync.Mutex
+	fetched  time.Time
+	failed   time.Time
+	fetching bool
+	trackers []string
+}
+
+// get returns the tracker list, fetching it again once it is older than the
+// refresh interval. If the fetch fails the previously fetched list is returned
+// along with the error, and fetching isn't tried again for trackerListRetry.
+// While another call is fetching, the previous list is returned right away
+// rather than waiting for a possibly slow server.
+func (l *trackerList) get() ([]string, error) {
+	l.mu.Lock()
+	fresh := !l.fetched.IsZero() && time.Since(l.fetched) < l.refresh
+	backingOff := !l.failed.IsZero() && time.Since(l.failed) < trackerListRetry
+	if fresh || backingOff || l.fetching {
+		defer l.mu.Unlock()
+		return l.trackers, nil
+	}
+	l.fetching = true
+	l.mu.Unlock()
+
+	trackers, err := l.fetch()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.fetching = false
+	if err != nil {
+		l.failed = time.Now()
+		return l.trackers, err
+	}
+	l.trackers = trackers
+	l.fetched = time.Now()
+	l.failed = time.Time{}
+	return l.trackers, nil
+}
+
+// fetch downloads the list: one tracker URL per line, ignoring blank lines and
+// # comments. Lines that aren't URLs of a tracker protocol we have a client
+// for are skipped, and anything past maxTrackerListSize is ignored.
+func (l *trackerList) fetch() ([]string, error) {
+	resp, err := l.client.Get(l.url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch tracker list: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("tracker list returned non-200 status: %s", resp.Status)
+	}
+
+	var trackers []string
+	scanner := bufio.NewScanner(io.LimitReader(resp.Body, maxTrackerListSize))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if u, _, err := torrent.LookupTrackerClient(line); err != nil || u.Host == "" {
+			continue
+		}
+		trackers = append(trackers, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read tracker list: %w", err)
+	}
+	return trackers, nil
+}
@@ -0,0 +1,60 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ayu-ch/bittorrent-client/torrent"
+)
+
+const (
+	// trackerPreferenceTTL is how long a host's BEP 34 record is reused.
+	trackerPreferenceTTL = 30 * time.Minute
+	// trackerPreferenceTimeout bounds the TXT lookup so a slow resolver doesn't hold up announces.
+	trackerPreferenceTimeout = 5 * time.Second
+)
+
+// trackerPreferenceEntry is a cached BEP 34 lookup; pref is nil for hosts without a record.
+type trackerPreferenceEntry struct {
+	pref    *torrent.TrackerPreference
+	expires time.Time
+}
+
+// trackerURLs parses tracker and returns the URLs to contact it on, in order,
+// following the preference its operator publishes in DNS.
+func (s *Session) trackerURLs(tracker string) ([]*url.URL, error) {
+	u, err := url.Parse(tracker)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse announce URL: %w", err)
+	}
+	if !s.dnsTrackerPrefs {
+		return []*url.URL{u}, nil
+	}
+	return s.trackerPreference(u.Hostname()).Apply(u)
+}
+
+// trackerPreference returns the BEP 34 preference of host, looking it up if it isn't cached.
+func (s *Session) trackerPreference(host string) *torrent.TrackerPreference {
+	host = strings.ToLower(host)
+	s.prefMu.Lock()
+	entry, ok := s.trackerPrefs[host]
+	s.prefMu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.pref
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), trackerPreferenceTimeout)
+	defer cancel()
+	pref := torrent.LookupTrackerPreference(ctx, s.resolver, host)
+	if pref != nil {
+		s.logger.Printf("tracker host %s publishes a BEP 34 record: %+v", host, *pref)
+	}
+
+	s.prefMu.Lock()
+	s.trackerPrefs[host] = trackerPreferenceEntry{pref: pref, expires: time.Now().Add(trackerPreferenceTTL)}
+	s.prefMu.Unlock()
+	return pref
+}
@@ -0,0 +1,247 @@
+package torrent
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// dnsCacheTTL is how long resolved tracker addresses are reused.
+	dnsCacheTTL = 5 * time.Minute
+	// fallbackDelay is how long to wait on the preferred address family before racing the other one.
+	fallbackDelay = 300 * time.Millisecond
+)
+
+// Dialer opens outgoing connections. *net.Dialer implements it, as do
+// SOCKS dialers for routing traffic over Tor or similar transports.
+type Dialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// networkDialer restricts a dialer to a single address family.
+type networkDialer struct {
+	dialer  Dialer
+	network string
+}
+
+// DialContext connects to address, replacing a generic "tcp" network with the configured one.
+func (d networkDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	if network == "tcp" {
+		network = d.network
+	}
+	return d.dialer.DialContext(ctx, network, address)
+}
+
+// newTrackerHTTPClient returns an HTTP client that dials through d.
+func newTrackerHTTPClient(d Dialer) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = d.DialContext
+	return &http.Client{
+		Transport: transport,
+		Timeout:   30 * time.Second,
+	}
+}
+
+// dnsEntry is a cached lookup result.
+type dnsEntry struct {
+	addrs   []net.IPAddr
+	expires time.Time
+}
+
+// cachingDialer resolves host names through a small cache and dials the
+// resulting addresses using Happy Eyeballs (RFC 8305), so a broken address
+// family doesn't stall every connection until it times out.
+type cachingDialer struct {
+	dialer   *net.Dialer
+	resolver *net.Resolver
+
+	mu    sync.Mutex
+	cache map[string]dnsEntry
+}
+
+// newCachingDialer returns a cachingDialer that connects through dialer.
+// A nil dialer uses default timeouts.
+func newCachingDialer(dialer *net.Dialer) *cachingDialer {
+	if dialer == nil {
+		dialer = &net.Dialer{Timeout: 15 * time.Second, KeepAlive: 30 * time.Second}
+	}
+	resolver := dialer.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	return &cachingDialer{
+		dialer:   dialer,
+		resolver: resolver,
+		cache:    make(map[string]dnsEntry),
+	}
+}
+
+// lookup returns the addresses of host, using a cached result while it is
+// fresh. Storing a new result drops the expired ones, so hosts that are no
+// longer dialed don't stay in the cache.
+func (d *cachingDialer) lookup(ctx context.Context, host string) ([]net.IPAddr, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return []net.IPAddr{{IP: ip}}, nil
+	}
+
+	d.mu.Lock()
+	entry, ok := d.cache[host]
+	d.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.addrs, nil
+	}
+
+	addrs, err := d.resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	d.mu.Lock()
+	for h, e := range d.cache {
+		if !now.Before(e.expires) {
+			delete(d.cache, h)
+		}
+	}
+	d.cache[host] = dnsEntry{addrs: addrs, expires: now.Add(dnsCacheTTL)}
+	d.mu.Unlock()
+	return addrs, nil
+}
+
+// DialContext connects to address on the named network.
+func (d *cachingDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := d.lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	addrs = filterFamily(network, addrs)
+	if len(addrs) == 0 {
+		return nil, &net.AddrError{Err: "no suitable address found", Addr: address}
+	}
+
+	// The family of the first resolved address is preferred, the other one is the fallback.
+	var primaries, fallbacks []string
+	primaryIPv4 := isIPv4(addrs[0].IP)
+	for _, addr := range addrs {
+		hostPort := net.JoinHostPort(addr.String(), port)
+		if isIPv4(addr.IP) == primaryIPv4 {
+			primaries = append(primaries, hostPort)
+		} else {
+			fallbacks = append(fallbacks, hostPort)
+		}
+	}
+
+	return d.dialParallel(ctx, network, primaries, fallbacks)
+}
+
+// dialParallel races the primary addresses against the fallbacks, giving the primaries a head start.
+func (d *cachingDialer) dialParallel(ctx context.Context, network string, primaries, fallbacks []string) (net.Conn, error) {
+	if len(fallbacks) == 0 {
+		return d.dialSerial(ctx, network, primaries)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		conn    net.Conn
+		err     error
+		primary bool
+	}
+	results := make(chan result)
+	start := func(addrs []string, primary bool) {
+		conn, err := d.dialSerial(ctx, network, addrs)
+		select {
+		case results <- result{conn: conn, err: err, primary: primary}:
+		case <-ctx.Done():
+			if conn != nil {
+				conn.Close()
+			}
+		}
+	}
+
+	go start(primaries, true)
+	fallbackTimer := time.NewTimer(fallbackDelay)
+	defer fallbackTimer.Stop()
+
+	var primaryErr error
+	fallbackStarted := false
+	pending := 1
+	for {
+		select {
+		case <-fallbackTimer.C:
+			if !fallbackStarted {
+				fallbackStarted = true
+				pending++
+				go start(fallbacks, false)
+			}
+		case res := <-results:
+			pending--
+			if res.err == nil {
+				return res.conn, nil
+			}
+			if res.primary || primaryErr == nil {
+				primaryErr = res.err
+			}
+			if !fallbackStarted {
+				fallbackStarted = true
+				pending++
+				go start(fallbacks, false)
+			}
+			if pending == 0 {
+				return nil, primaryErr
+			}
+		}
+	}
+}
+
+// dialSerial tries each address in turn and returns the first successful connection.
+func (d *cachingDialer) dialSerial(ctx context.Context, network string, addrs []string) (net.Conn, error) {
+	var lastErr error
+	for _, addr := range addrs {
+		conn, err := d.dialer.DialContext(ctx, network, addr)
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	if lastErr == nil {
+		lastErr = errors.New("no addresses to dial")
+	}
+	return nil, lastErr
+}
+
+// filterFamily drops addresses that can't be used on network, such as IPv6 addresses for "tcp4".
+func filterFamily(network string, addrs []net.IPAddr) []net.IPAddr {
+	var filtered []net.IPAddr
+	for _, addr := range addrs {
+		switch network {
+		case "tcp4", "udp4":
+			if !isIPv4(addr.IP) {
+				continue
+			}
+		case "tcp6", "udp6":
+			if isIPv4(addr.IP) {
+				continue
+			}
+		}
+		filtered = append(filtered, addr)
+	}
+	return filtered
+}
+
+func isIPv4(ip net.IP) bool {
+	return ip.To4() != nil
+}
@@ -0,0 +1,26 @@
+package torrent
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestCachingDialerEvictsExpired(t *testing.T) {
+	d := newCachingDialer(nil)
+	d.cache["stale.example"] = dnsEntry{addrs: []net.IPAddr{{IP: net.IPv4(192, 0, 2, 1)}}, expires: time.Now().Add(-time.Second)}
+	d.cache["fresh.example"] = dnsEntry{addrs: []net.IPAddr{{IP: net.IPv4(192, 0, 2, 2)}}, expires: time.Now().Add(time.Minute)}
+
+	if _, err := d.lookup(context.Background(), "localhost"); err != nil {
+		t.Skipf("can't resolve localhost: %v", err)
+	}
+	if _, ok := d.cache["stale.example"]; ok {
+		t.Error("expired entry still cached after a lookup")
+	}
+	for _, host := range []string{"fresh.example", "localhost"} {
+		if _, ok := d.cache[host]; !ok {
+			t.Errorf("%s missing from the cache", host)
+		}
+	}
+}
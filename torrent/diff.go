@@ -0,0 +1,116 @@
+package torrent
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Diff describes how two torrents differ.
+type Diff struct {
+	// SameInfoHash is set when both torrents have the same info hash.
+	SameInfoHash bool
+	// SameContent is set when both torrents describe identical files with identical piece hashes.
+	SameContent bool
+	// Differences lists each difference in a human-readable form.
+	Differences []string
+}
+
+// Compare reports the differences between a and b.
+func Compare(a, b *Torrent) Diff {
+	d := Diff{SameInfoHash: a.InfoHash == b.InfoHash}
+	addf := func(format string, args ...any) {
+		d.Differences = append(d.Differences, fmt.Sprintf(format, args...))
+	}
+
+	if a.Info.Name != b.Info.Name {
+		addf("name: %q != %q", a.Info.Name, b.Info.Name)
+	}
+
+	filesMatch := compareFiles(relativeFiles(a.Info), relativeFiles(b.Info), addf)
+
+	piecesMatch := false
+	if a.Info.PieceLength != b.Info.PieceLength {
+		addf("piece length: %d != %d", a.Info.PieceLength, b.Info.PieceLength)
+	} else if len(a.Info.Pieces) != len(b.Info.Pieces) {
+		addf("piece count: %d != %d", len(a.Info.Pieces), len(b.Info.Pieces))
+	} else {
+		differing := 0
+		for i := range a.Info.Pieces {
+			if a.Info.Pieces[i] != b.Info.Pieces[i] {
+				differing++
+			}
+		}
+		if differing > 0 {
+			addf("piece hashes: %d of %d differ", differing, len(a.Info.Pieces))
+		}
+		piecesMatch = differing == 0
+	}
+
+	compareTrackers(a.Trackers(), b.Trackers(), addf)
+
+	d.SameContent = d.SameInfoHash || (filesMatch && piecesMatch)
+	return d
+}
+
+// relativeFiles returns the files relative to the torrent's root, so that a
+// renamed single-file torrent still compares equal to the original.
+func relativeFiles(info Info) []File {
+	if len(info.Files) == 0 {
+		return []File{{Length: info.Length}}
+	}
+	return info.Files
+}
+
+// compareFiles reports files missing from either side or with different sizes.
+func compareFiles(a, b []File, addf func(string, ...any)) bool {
+	sizes := make(map[string]int64, len(b))
+	for _, f := range b {
+		sizes[strings.Join(f.Path, "/")] = f.Length
+	}
+
+	match := len(a) == len(b)
+	seen := make(map[string]bool, len(a))
+	for i, f := range a {
+		p := strings.Join(f.Path, "/")
+		seen[p] = true
+		size, ok := sizes[p]
+		switch {
+		case !ok:
+			addf("file only in first: %s", p)
+			match = false
+		case size != f.Length:
+			addf("file size: %s: %d != %d", p, f.Length, size)
+			match = false
+		case match && p != strings.Join(b[i].Path, "/"):
+			addf("file order differs at index %d: %s != %s", i, p, strings.Join(b[i].Path, "/"))
+			match = false
+		}
+	}
+	for _, f := range b {
+		if p := strings.Join(f.Path, "/"); !seen[p] {
+			addf("file only in second: %s", p)
+			match = false
+		}
+	}
+	return match
+}
+
+// compareTrackers reports trackers present in only one of the lists.
+func compareTrackers(a, b []string, addf func(string, ...any)) {
+	inA := make(map[string]bool, len(a))
+	for _, u := range a {
+		inA[u] = true
+	}
+	inB := make(map[string]bool, len(b))
+	for _, u := range b {
+		inB[u] = true
+		if !inA[u] {
+			addf("tracker only in second: %s", u)
+		}
+	}
+	for _, u := range a {
+		if !inB[u] {
+			addf("tracker only in first: %s", u)
+		}
+	}
+}
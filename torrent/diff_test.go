@@ -0,0 +1,59 @@
+package torrent
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCompareSameContent(t *testing.T) {
+	content := []byte("0123456789ab")
+	a := &Torrent{InfoHash: [20]byte{1}, Info: multiFileInfo(content, 6, 6), Announce: "http://a.example/announce"}
+	b := &Torrent{InfoHash: [20]byte{2}, Info: multiFileInfo(content, 6, 6), Announce: "http://b.example/announce"}
+	b.Info.Name = "renamed"
+
+	d := Compare(a, b)
+	if d.SameInfoHash {
+		t.Error("SameInfoHash set for different info hashes")
+	}
+	if !d.SameContent {
+		t.Errorf("SameContent not set for the same files and pieces: %q", d.Differences)
+	}
+	want := []string{
+		`name: "multi" != "renamed"`,
+		"tracker only in second: http://b.example/announce",
+		"tracker only in first: http://a.example/announce",
+	}
+	if strings.Join(d.Differences, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Differences = %q, want %q", d.Differences, want)
+	}
+}
+
+func TestCompareMovedBoundary(t *testing.T) {
+	// The same bytes split differently between the files hash to the same
+	// pieces, but the piece spanning the boundary belongs to other files.
+	content := []byte("0123456789ab")
+	a := &Torrent{InfoHash: [20]byte{1}, Info: multiFileInfo(content, 6, 6)}
+	b := &Torrent{InfoHash: [20]byte{2}, Info: multiFileInfo(content, 5, 7)}
+
+	d := Compare(a, b)
+	if d.SameContent {
+		t.Error("SameContent set for files of different sizes")
+	}
+	want := []string{"file size: dir/a: 6 != 5", "file size: dir/b: 6 != 7"}
+	if strings.Join(d.Differences, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Differences = %q, want %q", d.Differences, want)
+	}
+}
+
+func TestCompareSpanningPiece(t *testing.T) {
+	a := &Torrent{InfoHash: [20]byte{1}, Info: multiFileInfo([]byte("0123456789ab"), 6, 6)}
+	b := &Torrent{InfoHash: [20]byte{2}, Info: multiFileInfo([]byte("01234x6789ab"), 6, 6)}
+
+	d := Compare(a, b)
+	if d.SameContent {
+		t.Error("SameContent set although the piece spanning both files differs")
+	}
+	if want := []string{"piece hashes: 1 of 3 differ"}; strings.Join(d.Differences, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Differences = %q, want %q", d.Differences, want)
+	}
+}
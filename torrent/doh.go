@@ -0,0 +1,127 @@
+package torrent
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// maxDoHResponse bounds the size of a DNS-over-HTTPS answer; DNS messages can't exceed 64KiB.
+const maxDoHResponse = 65535
+
+// NewDoHResolver returns a resolver that sends its queries to the
+// DNS-over-HTTPS server at serverURL (RFC 8484), for example
+// https://1.1.1.1/dns-query, so tracker names resolve even where the local
+// DNS blocks them. Only lookups made through the returned resolver are
+// affected. The server's own host name, if any, is resolved by client, which
+// defaults to one using the system resolver.
+func NewDoHResolver(serverURL string, client *http.Client) *net.Resolver {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			return &dohConn{ctx: ctx, url: serverURL, client: client}, nil
+		},
+	}
+}
+
+// dohConn carries the Go resolver's DNS messages over HTTPS. It looks like a
+// stream connection to the resolver, so every query is written with a
+// two-byte length prefix and each answer is read back the same way.
+type dohConn struct {
+	ctx      context.Context
+	url      string
+	client   *http.Client
+	deadline time.Time
+
+	query    bytes.Buffer
+	response bytes.Buffer
+}
+
+// Write buffers a query and sends it once it is complete.
+func (c *dohConn) Write(b []byte) (int, error) {
+	c.query.Write(b)
+	for c.query.Len() >= 2 {
+		size := int(binary.BigEndian.Uint16(c.query.Bytes()))
+		if c.query.Len() < 2+size {
+			break
+		}
+		msg := make([]byte, size)
+		copy(msg, c.query.Bytes()[2:])
+		c.query.Next(2 + size)
+
+		answer, err := c.roundTrip(msg)
+		if err != nil {
+			return 0, err
+		}
+		c.response.Write(binary.BigEndian.AppendUint16(nil, uint16(len(answer))))
+		c.response.Write(answer)
+	}
+	return len(b), nil
+}
+
+// roundTrip posts a DNS message to the server and returns its answer.
+func (c *dohConn) roundTrip(msg []byte) ([]byte, error) {
+	ctx := c.ctx
+	if !c.deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, c.deadline)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(msg))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build DNS-over-HTTPS request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("DNS-over-HTTPS request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("DNS-over-HTTPS server returned non-200 status: %s", resp.Status)
+	}
+	answer, err := io.ReadAll(io.LimitReader(resp.Body, maxDoHResponse+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read DNS-over-HTTPS response: %w", err)
+	}
+	if len(answer) > maxDoHResponse {
+		return nil, fmt.Errorf("DNS-over-HTTPS response is too large")
+	}
+	return answer, nil
+}
+
+// Read returns the buffered answers.
+func (c *dohConn) Read(b []byte) (int, error) {
+	if c.response.Len() == 0 {
+		return 0, io.EOF
+	}
+	return c.response.Read(b)
+}
+
+func (c *dohConn) Close() error         { return nil }
+func (c *dohConn) LocalAddr() net.Addr  { return dohAddr{} }
+func (c *dohConn) RemoteAddr() net.Addr { return dohAddr{} }
+
+func (c *dohConn) SetDeadline(t time.Time) error {
+	c.deadline = t
+	return nil
+}
+
+func (c *dohConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *dohConn) SetWriteDeadline(t time.Time) error { return c.SetDeadline(t) }
+
+// dohAddr is the placeholder address of a dohConn.
+type dohAddr struct{}
+
+func (dohAddr) Network() string { return "doh" }
+func (dohAddr) String() string  { return "doh" }
@@ -0,0 +1,87 @@
+package torrent
+
+import "fmt"
+
+// FileExtent locates a file within the torrent's concatenated content.
+type FileExtent struct {
+	File
+	// Offset is the position of the file's first byte in the torrent's content.
+	Offset int64
+}
+
+// FileExtents returns the files of the torrent with their content offsets.
+// A single-file torrent has one file whose path is the torrent name.
+func (info Info) FileExtents() []FileExtent {
+	if len(info.Files) == 0 {
+		return []FileExtent{{File: File{Length: info.Length, Path: []string{info.Name}}}}
+	}
+	extents := make([]FileExtent, len(info.Files))
+	var offset int64
+	for i, f := range info.Files {
+		extents[i] = FileExtent{File: f, Offset: offset}
+		offset += f.Length
+	}
+	return extents
+}
+
+// PieceSize returns the length of piece index, which is shorter than PieceLength for the last piece.
+func (info Info) PieceSize(index int) int64 {
+	start := int64(index) * info.PieceLength
+	return min(info.PieceLength, info.TotalLength()-start)
+}
+
+// PieceRange returns the half-open range of pieces [first, end) holding the
+// content bytes [offset, offset+length).
+func (info Info) PieceRange(offset, length int64) (first, end int) {
+	if info.PieceLength <= 0 || length <= 0 {
+		return 0, 0
+	}
+	first = int(offset / info.PieceLength)
+	end = int((offset+length-1)/info.PieceLength) + 1
+	return first, end
+}
+
+// FilePieceRange returns the half-open range of pieces [first, end) holding
+// length bytes starting at offset within file fileIndex. Pieces at either end
+// may be shared with neighbouring files.
+func (info Info) FilePieceRange(fileIndex int, offset, length int64) (first, end int, err error) {
+	extents := info.FileExtents()
+	if fileIndex < 0 || fileIndex >= len(extents) {
+		return 0, 0, fmt.Errorf("file index %d out of range, torrent has %d files", fileIndex, len(extents))
+	}
+	f := extents[fileIndex]
+	if offset < 0 || length <= 0 || offset > f.Length-length {
+		return 0, 0, fmt.Errorf("range %d+%d is outside file %d of %d bytes", offset, length, fileIndex, f.Length)
+	}
+	first, end = info.PieceRange(f.Offset+offset, length)
+	return first, end, nil
+}
+
+// FileCompletion returns the fraction of each file, in FileExtents order,
+// that is covered by verified pieces. verified is indexed by piece.
+func (info Info) FileCompletion(verified []bool) []float64 {
+	extents := info.FileExtents()
+	completion := make([]float64, len(extents))
+	if info.PieceLength <= 0 {
+		return completion
+	}
+
+	for i, e := range extents {
+		if e.Length == 0 {
+			completion[i] = 1
+			continue
+		}
+		var done int64
+		end := e.Offset + e.Length
+		for piece := e.Offset / info.PieceLength; piece*info.PieceLength < end; piece++ {
+			if piece >= int64(len(verified)) || !verified[piece] {
+				continue
+			}
+			start := max(piece*info.PieceLength, e.Offset)
+			stop := min((piece+1)*info.PieceLength, end)
+			done += stop - start
+		}
+		completion[i] = float64(done) / float64(e.Length)
+	}
+	return completion
+}
@@ -0,0 +1,87 @@
+package torrent
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const (
+	gib = int64(1) << 30
+	mib = int64(1) << 20
+)
+
+// largeInfo is a torrent of a 5 GiB and a 3 GiB file with 4 MiB pieces.
+func largeInfo() Info {
+	return Info{
+		Name:        "large",
+		PieceLength: 4 * mib,
+		Pieces:      make([][20]byte, 8*gib/(4*mib)),
+		Files: []File{
+			{Length: 5 * gib, Path: []string{"a"}},
+			{Length: 3 * gib, Path: []string{"b"}},
+		},
+	}
+}
+
+func TestLargeInfoLengths(t *testing.T) {
+	info := largeInfo()
+	if err := info.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if got := info.TotalLength(); got != 8*gib {
+		t.Errorf("TotalLength = %d, want %d", got, 8*gib)
+	}
+	extents := info.FileExtents()
+	if extents[1].Offset != 5*gib {
+		t.Errorf("second file offset = %d, want %d", extents[1].Offset, 5*gib)
+	}
+	if got := info.PieceSize(len(info.Pieces) - 1); got != 4*mib {
+		t.Errorf("last piece size = %d, want %d", got, 4*mib)
+	}
+}
+
+func TestFilePieceRangeAbove4GiB(t *testing.T) {
+	info := largeInfo()
+	tests := []struct {
+		file           int
+		offset, length int64
+		first, end     int
+	}{
+		{0, 0, 5 * gib, 0, 1280},
+		{0, 4*gib + 1, 1, 1024, 1025},
+		{0, 5*gib - 1, 1, 1279, 1280},
+		{1, 0, 3 * gib, 1280, 2048},
+		{1, 2 * gib, 4 * mib, 1792, 1793},
+		{1, 3*gib - 1, 1, 2047, 2048},
+	}
+	for _, tt := range tests {
+		first, end, err := info.FilePieceRange(tt.file, tt.offset, tt.length)
+		if err != nil {
+			t.Errorf("FilePieceRange(%d, %d, %d): %v", tt.file, tt.offset, tt.length, err)
+			continue
+		}
+		if first != tt.first || end != tt.end {
+			t.Errorf("FilePieceRange(%d, %d, %d) = %d, %d, want %d, %d", tt.file, tt.offset, tt.length, first, end, tt.first, tt.end)
+		}
+	}
+
+	if _, _, err := info.FilePieceRange(1, 3*gib, 1); err == nil {
+		t.Error("FilePieceRange past the end of a 3 GiB file succeeded")
+	}
+}
+
+func TestNewTorrentFromBencodeAbove4GiB(t *testing.T) {
+	pieces := strings.Repeat("x", int(5*gib/(4*mib))*20)
+	data := metainfoWithInfo("6:lengthi5368709120e4:name1:a12:piece lengthi4194304e6:pieces" + strconv.Itoa(len(pieces)) + ":" + pieces)
+	tor, err := NewTorrentFromBencode(data)
+	if err != nil {
+		t.Fatalf("NewTorrentFromBencode: %v", err)
+	}
+	if tor.Info.Length != 5*gib || tor.Info.TotalLength() != 5*gib {
+		t.Errorf("Length = %d, want %d", tor.Info.Length, 5*gib)
+	}
+	if len(tor.Info.Pieces) != 1280 {
+		t.Errorf("got %d pieces, want 1280", len(tor.Info.Pieces))
+	}
+}
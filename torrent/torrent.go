@@ -3,32 +3,34 @@ package torrent
 import (
 	"crypto/sha1"
 	"fmt"
-	"io/ioutil"
-	"net/http"
-	"net/url"
 	"os"
-	"strconv"
 
 	"github.com/ayu-ch/bittorrent-client/pkg/bencode"
 )
 
 type Torrent struct {
-	InfoHash [20]byte
-	Info     Info
-	Announce string
+	InfoHash     [20]byte
+	Info         Info
+	Announce     string
+	AnnounceList [][]string
+
+	// infoDict is the info dictionary as read from the .torrent file, used to
+	// compute the info hash exactly, including keys Info doesn't model.
+	infoDict bencode.Dict
 }
 
 type Info struct {
 	Name        string
-	PieceLength int
+	PieceLength int64
 	Pieces      [][20]byte
-	Length      int
+	Length      int64
 	Files       []File
+	Private     bool
 }
 
 type File struct {
-	Length int
-	Path   []string
+	Length int64    `bencode:"length"`
+	Path   []string `bencode:"path"`
 }
 
 // NewTorrent initializes a Torrent object from a .torrent file.
@@ -40,21 +42,41 @@ func NewTorrent(filename string) (*Torrent, error) {
 	return NewTorrentFromBencode(fileData)
 }
 
+// metainfo is the layout of a .torrent file.
+type metainfo struct {
+	Announce     string       `bencode:"announce"`
+	AnnounceList [][]string   `bencode:"announce-list"`
+	Info         bencode.Dict `bencode:"info"`
+}
+
+// infoFields is the layout of the info dictionary.
+type infoFields struct {
+	Name        string `bencode:"name"`
+	PieceLength int64  `bencode:"piece length"`
+	Pieces      string `bencode:"pieces"`
+	Length      int64  `bencode:"length"`
+	Files       []File `bencode:"files"`
+	Private     int64  `bencode:"private"`
+}
+
 // NewTorrentFromBencode initializes a Torrent object from bencoded data.
 func NewTorrentFromBencode(bencoded []byte) (*Torrent, error) {
-	unmarshalledData, err := bencode.Unmarshal(bencoded)
-	if err != nil {
+	var m metainfo
+	if err := bencode.Unmarshal(bencoded, &m); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal bencoded data: %w", err)
 	}
 
-	t := &Torrent{}
-	for key, value := range unmarshalledData.(map[string]any) {
-		switch key {
-		case "info":
-			t.Info = newInfo(value.(map[string]any))
-		case "announce":
-			t.Announce = value.(string)
+	t := &Torrent{Announce: m.Announce, AnnounceList: m.AnnounceList}
+	if m.Info != nil {
+		var err error
+		if t.Info, err = newInfo(m.Info); err != nil {
+			return nil, fmt.Errorf("failed to parse info: %w", err)
 		}
+		t.infoDict = m.Info
+	}
+
+	if err := t.Info.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid torrent: %w", err)
 	}
 
 	if err := t.updateInfoHash(); err != nil {
@@ -64,51 +86,95 @@ func NewTorrentFromBencode(bencoded []byte) (*Torrent, error) {
 	return t, nil
 }
 
-// newInfo constructs an Info object from bencoded data.
-func newInfo(m map[string]any) Info {
-	info := Info{}
-	for key, value := range m {
-		switch key {
-		case "name":
-			info.Name = value.(string)
-		case "piece length":
-			info.PieceLength = value.(int)
-		case "pieces":
-			piecesStr := value.(string)
-			info.Pieces = make([][20]byte, len(piecesStr)/20)
-			for i := 0; i < len(piecesStr); i += 20 {
-				copy(info.Pieces[i/20][:], piecesStr[i:i+20])
-			}
-		case "length":
-			info.Length = value.(int)
-		case "files":
-			for _, file := range value.([]any) {
-				info.Files = append(info.Files, newFile(file.(map[string]any)))
+// newInfo constructs an Info object from the bencoded info dictionary.
+func newInfo(d bencode.Dict) (Info, error) {
+	var fields infoFields
+	if err := bencode.UnmarshalValue(d, &fields); err != nil {
+		return Info{}, err
+	}
+	if len(fields.Pieces)%20 != 0 {
+		return Info{}, fmt.Errorf("pieces length %d is not a multiple of 20", len(fields.Pieces))
+	}
+	info := Info{
+		Name:        fields.Name,
+		PieceLength: fields.PieceLength,
+		Pieces:      make([][20]byte, len(fields.Pieces)/20),
+		Length:      fields.Length,
+		Files:       fields.Files,
+		Private:     fields.Private == 1,
+	}
+	for i := range info.Pieces {
+		copy(info.Pieces[i][:], fields.Pieces[i*20:])
+	}
+	return info, nil
+}
+
+// Trackers returns every tracker URL of the torrent, announce-list tiers first, without duplicates.
+func (t *Torrent) Trackers() []string {
+	var trackers []string
+	for _, tier := range t.Tiers() {
+		trackers = append(trackers, tier...)
+	}
+	return trackers
+}
+
+// Tiers returns the torrent's trackers grouped into announce-list tiers
+// (BEP 12), without duplicates. Without an announce-list the announce URL
+// forms the only tier.
+func (t *Torrent) Tiers() [][]string {
+	seen := make(map[string]bool)
+	var tiers [][]string
+	for _, tier := range t.AnnounceList {
+		var urls []string
+		for _, u := range tier {
+			if u != "" && !seen[u] {
+				seen[u] = true
+				urls = append(urls, u)
 			}
 		}
+		if len(urls) > 0 {
+			tiers = append(tiers, urls)
+		}
+	}
+	if t.Announce != "" && !seen[t.Announce] {
+		tiers = append(tiers, []string{t.Announce})
 	}
-	return info
+	return tiers
 }
 
-// newFile constructs a File object from bencoded data.
-func newFile(m map[string]any) File {
-	f := File{}
-	for key, value := range m {
-		switch key {
-		case "length":
-			f.Length = value.(int)
-		case "path":
-			for _, path := range value.([]any) {
-				f.Path = append(f.Path, path.(string))
-			}
+// AddTrackers appends the given trackers that the torrent doesn't already use as a new tier.
+func (t *Torrent) AddTrackers(trackers []string) {
+	existing := make(map[string]bool)
+	for _, u := range t.Trackers() {
+		existing[u] = true
+	}
+
+	var tier []string
+	for _, u := range trackers {
+		if u != "" && !existing[u] {
+			existing[u] = true
+			tier = append(tier, u)
 		}
 	}
-	return f
+	if len(tier) == 0 {
+		return
+	}
+
+	// Once there is an announce-list, the plain announce URL is ignored, so keep it as the first tier.
+	if len(t.AnnounceList) == 0 && t.Announce != "" {
+		t.AnnounceList = [][]string{{t.Announce}}
+	}
+	t.AnnounceList = append(t.AnnounceList, tier)
 }
 
-// updateInfoHash calculates the SHA1 hash of the info dictionary.
+// updateInfoHash calculates the SHA1 hash of the info dictionary. The
+// dictionary read from the .torrent file is preferred, since re-encoding it
+// in its original order reproduces the original bytes.
 func (t *Torrent) updateInfoHash() error {
-	info := marshallableInfo(t.Info)
+	var info any = t.infoDict
+	if t.infoDict == nil {
+		info = marshallableInfo(t.Info)
+	}
 	infoBencoded, err := bencode.Marshal(info)
 	if err != nil {
 		return fmt.Errorf("failed to marshal info for hash: %w", err)
@@ -130,6 +196,10 @@ func marshallableInfo(info Info) map[string]any {
 		m["pieces"] = append(m["pieces"].([]byte), piece[:]...)
 	}
 
+	if info.Private {
+		m["private"] = 1
+	}
+
 	if len(info.Files) > 0 {
 		m["files"] = []any{}
 	} else {
@@ -153,94 +223,3 @@ func marshallableFile(f File) map[string]any {
 	}
 	return m
 }
-
-// buildTrackerURL constructs the tracker announce URL.
-func (t *Torrent) buildTrackerURL(peerID [20]byte, port uint16) (string, error) {
-	base, err := url.Parse(t.Announce)
-	if err != nil {
-		return "", fmt.Errorf("failed to parse announce URL: %w", err)
-	}
-
-	params := url.Values{
-		"info_hash":  {string(t.InfoHash[:])},
-		"peer_id":    {string(peerID[:])},
-		"port":       {strconv.Itoa(int(port))},
-		"uploaded":   {"0"},
-		"downloaded": {"0"},
-		"compact":    {"1"},
-		"left":       {strconv.Itoa(t.Info.Length)}, // Total length of the file
-	}
-
-	base.RawQuery = params.Encode()
-	return base.String(), nil
-}
-
-// AnnounceToTracker sends a GET request to the tracker to announce the peer.
-func (t *Torrent) AnnounceToTracker(peerID [20]byte, port uint16) error {
-	trackerURL, err := t.buildTrackerURL(peerID, port)
-	if err != nil {
-		return fmt.Errorf("failed to build tracker URL: %w", err)
-	}
-
-	resp, err := http.Get(trackerURL)
-	if err != nil {
-		return fmt.Errorf("failed to announce to tracker: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("tracker returned non-200 status: %s", resp.Status)
-	}
-
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return fmt.Errorf("failed to read tracker response: %w", err)
-	}
-
-	return t.parseTrackerResponse(body)
-}
-
-// parseTrackerResponse parses the bencoded response from the tracker.
-func (t *Torrent) parseTrackerResponse(data []byte) error {
-	response, err := bencode.Unmarshal(data)
-	if err != nil {
-		return fmt.Errorf("failed to unmarshal tracker response: %w", err)
-	}
-
-	trackerData := response.(map[string]any)
-
-	// Print the entire response for debugging
-	fmt.Printf("Raw tracker response: %+v\n", trackerData)
-
-	// Extract interval
-	if interval, ok := trackerData["interval"].(int); ok {
-		fmt.Printf("Tracker interval: %d seconds\n", interval)
-	} else {
-		return fmt.Errorf("invalid or missing interval in tracker response")
-	}
-
-	// Extract peers
-	if peersData, ok := trackerData["peers"]; ok {
-		switch peers := peersData.(type) {
-		case string:
-			t.parsePeers(peers)
-		default:
-			return fmt.Errorf("invalid peers data type")
-		}
-	} else {
-		return fmt.Errorf("missing peers in tracker response")
-	}
-
-	return nil
-}
-
-// parsePeers extracts IP addresses and ports from the binary blob of peers.
-func (t *Torrent) parsePeers(peers string) {
-	numPeers := len(peers) / 6 // Each peer is 6 bytes
-	for i := 0; i < numPeers; i++ {
-		peer := peers[i*6 : (i+1)*6]
-		ip := fmt.Sprintf("%d.%d.%d.%d", peer[0], peer[1], peer[2], peer[3])
-		port := (uint16(peer[4]) << 8) | uint16(peer[5])
-		fmt.Printf("Peer: %s:%d\n", ip, port)
-	}
-}
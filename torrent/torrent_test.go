@@ -0,0 +1,100 @@
+package torrent
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// pieces20 is the pieces string of a single-piece torrent.
+var pieces20 = strings.Repeat("x", 20)
+
+// metainfoWithInfo returns a .torrent file whose info dictionary is the given bencoded entries.
+func metainfoWithInfo(entries string) []byte {
+	return []byte("d8:announce17:http://t/announce4:infod" + entries + "ee")
+}
+
+// validInfo are the entries of a valid single-file info dictionary.
+var validInfo = "6:lengthi100e4:name1:a12:piece lengthi16384e6:pieces20:" + pieces20
+
+func TestNewTorrentFromBencode(t *testing.T) {
+	tor, err := NewTorrentFromBencode(metainfoWithInfo(validInfo))
+	if err != nil {
+		t.Fatalf("NewTorrentFromBencode: %v", err)
+	}
+	if tor.Info.Name != "a" || tor.Info.Length != 100 || tor.Info.PieceLength != 16384 || len(tor.Info.Pieces) != 1 {
+		t.Errorf("got info %+v", tor.Info)
+	}
+	if tor.Announce != "http://t/announce" {
+		t.Errorf("got announce %q", tor.Announce)
+	}
+}
+
+func TestNewTorrentFromBencodeHostile(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{"empty input", "", "failed to unmarshal"},
+		{"root is a list", "l4:spame", "cannot decode list"},
+		{"root is an integer", "i42e", "cannot decode integer"},
+		{"root is a string", "4:spam", "cannot decode string"},
+		{"info is a string", "d4:info4:spame", "info: cannot decode string"},
+		{"info is a list", "d4:infoli1eee", "info: cannot decode list"},
+		{"info is an integer", "d4:infoi1ee", "info: cannot decode integer"},
+		{"info missing", "d8:announce1:ae", "empty name"},
+		{"announce is an integer", "d8:announcei1e4:infod" + validInfo + "ee", "announce: cannot decode integer"},
+		{"announce-list is a string", "d13:announce-list1:a4:infod" + validInfo + "ee", "announce-list: cannot decode string"},
+		{"announce-list tier is a string", "d13:announce-listl1:ae4:infod" + validInfo + "ee", "announce-list: 0: cannot decode string"},
+		{"name is an integer", string(metainfoWithInfo("6:lengthi100e4:namei1e12:piece lengthi16384e6:pieces20:" + pieces20)), "name: cannot decode integer"},
+		{"name is a list", string(metainfoWithInfo("6:lengthi100e4:namel1:ae12:piece lengthi16384e6:pieces20:" + pieces20)), "name: cannot decode list"},
+		{"piece length is a string", string(metainfoWithInfo("6:lengthi100e4:name1:a12:piece length5:16384" + "6:pieces20:" + pieces20)), "piece length: cannot decode string"},
+		{"piece length is a dict", string(metainfoWithInfo("6:lengthi100e4:name1:a12:piece lengthde6:pieces20:" + pieces20)), "piece length: cannot decode dictionary"},
+		{"pieces is an integer", string(metainfoWithInfo("6:lengthi100e4:name1:a12:piece lengthi16384e6:piecesi20e")), "pieces: cannot decode integer"},
+		{"pieces not a multiple of 20", string(metainfoWithInfo("6:lengthi100e4:name1:a12:piece lengthi16384e6:pieces19:" + pieces20[:19])), "not a multiple of 20"},
+		{"pieces of 21 bytes", string(metainfoWithInfo("6:lengthi100e4:name1:a12:piece lengthi16384e6:pieces21:" + pieces20 + "x")), "not a multiple of 20"},
+		{"length is a string", string(metainfoWithInfo("6:length3:1004:name1:a12:piece lengthi16384e6:pieces20:" + pieces20)), "length: cannot decode string"},
+		{"files is a string", string(metainfoWithInfo("5:files1:a4:name1:a12:piece lengthi16384e6:pieces20:" + pieces20)), "files: cannot decode string"},
+		{"file is a list", string(metainfoWithInfo("5:filesll1:aee4:name1:a12:piece lengthi16384e6:pieces20:" + pieces20)), "files: 0: cannot decode list"},
+		{"file length is a string", string(metainfoWithInfo("5:filesld6:length1:14:pathl1:aeee4:name1:a12:piece lengthi16384e6:pieces20:" + pieces20)), "files: 0: length: cannot decode string"},
+		{"path is a string", string(metainfoWithInfo("5:filesld6:lengthi1e4:path1:aee4:name1:a12:piece lengthi16384e6:pieces20:" + pieces20)), "files: 0: path: cannot decode string"},
+		{"path element is an integer", string(metainfoWithInfo("5:filesld6:lengthi1e4:pathli1eeee4:name1:a12:piece lengthi16384e6:pieces20:" + pieces20)), "files: 0: path: 0: cannot decode integer"},
+		{"negative string length", "d4:info-1:ae", "negative string length"},
+		{"oversized string length", "d4:info999999999:ae", "exceeds remaining input"},
+		{"string length overflows", "d4:info99999999999999999999:ae", "invalid string length"},
+		{"truncated dictionary", "d4:infod4:name1:a", "failed to unmarshal"},
+		{"integer overflows", string(metainfoWithInfo("6:lengthi99999999999999999999e4:name1:a12:piece lengthi16384e6:pieces20:" + pieces20)), "invalid integer"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewTorrentFromBencode([]byte(tt.data))
+			if err == nil {
+				t.Fatalf("NewTorrentFromBencode(%q) succeeded, want error containing %q", tt.data, tt.wantErr)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("NewTorrentFromBencode(%q) = %v, want error containing %q", tt.data, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewTorrentFromBencodeTruncated(t *testing.T) {
+	// No prefix of a valid torrent may panic or be accepted.
+	data := metainfoWithInfo(validInfo)
+	for i := range data {
+		if _, err := NewTorrentFromBencode(data[:i]); err == nil {
+			t.Errorf("prefix of %d bytes was accepted", i)
+		}
+	}
+}
+
+func ExampleNewTorrentFromBencode() {
+	tor, err := NewTorrentFromBencode(metainfoWithInfo(validInfo))
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(tor.Info.Name, tor.Info.TotalLength())
+	// Output: a 100
+}
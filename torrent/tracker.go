@@ -0,0 +1,145 @@
+package torrent
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/ayu-ch/bittorrent-client/pkg/tracker"
+)
+
+// ErrUnsupportedTrackerScheme is returned when no tracker client is registered for an announce URL scheme.
+var ErrUnsupportedTrackerScheme = errors.New("unsupported tracker scheme")
+
+// MaxTrackerPeers bounds the number of peers accepted from a single tracker response.
+const MaxTrackerPeers = tracker.MaxPeers
+
+// TrackerClient announces and scrapes a torrent on a tracker reachable through a particular URL scheme.
+type TrackerClient interface {
+	Announce(trackerURL *url.URL, t *Torrent, req AnnounceRequest) (*TrackerResponse, error)
+	Scrape(trackerURL *url.URL, t *Torrent) (*ScrapeResponse, error)
+}
+
+// AnnounceRequest holds the parameters of an announce that don't come from the torrent.
+type AnnounceRequest struct {
+	PeerID [20]byte
+	Port   uint16
+	// ExtraParams are added to the announce query, replacing standard parameters of the same name.
+	ExtraParams url.Values
+	// Event is "started", "completed", "stopped" or empty for a regular announce.
+	Event string
+}
+
+// TrackerResponse holds the result of an announce.
+type TrackerResponse = tracker.Response
+
+// ScrapeResponse holds the swarm statistics a tracker reports for a torrent.
+type ScrapeResponse = tracker.ScrapeResponse
+
+// Peer is the address of a peer returned by a tracker.
+type Peer = tracker.Peer
+
+var (
+	trackerSchemesMu sync.RWMutex
+	trackerSchemes   = map[string]TrackerClient{
+		"http":  defaultHTTPTracker,
+		"https": defaultHTTPTracker,
+	}
+)
+
+// RegisterTrackerScheme makes a tracker client available for announce URLs using the given scheme.
+func RegisterTrackerScheme(scheme string, client TrackerClient) {
+	trackerSchemesMu.Lock()
+	defer trackerSchemesMu.Unlock()
+	trackerSchemes[strings.ToLower(scheme)] = client
+}
+
+// LookupTrackerClient parses trackerURL and returns the tracker client registered for its scheme.
+func LookupTrackerClient(trackerURL string) (*url.URL, TrackerClient, error) {
+	u, err := url.Parse(trackerURL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse announce URL: %w", err)
+	}
+
+	trackerSchemesMu.RLock()
+	defer trackerSchemesMu.RUnlock()
+	client, ok := trackerSchemes[strings.ToLower(u.Scheme)]
+	if !ok {
+		return nil, nil, fmt.Errorf("%w %q", ErrUnsupportedTrackerScheme, u.Scheme)
+	}
+	return u, client, nil
+}
+
+// AnnounceToTracker announces the peer to the torrent's main tracker.
+func (t *Torrent) AnnounceToTracker(peerID [20]byte, port uint16) (*TrackerResponse, error) {
+	return t.AnnounceTo(t.Announce, peerID, port)
+}
+
+// AnnounceTo announces the peer to the given tracker using the client registered for its scheme.
+func (t *Torrent) AnnounceTo(trackerURL string, peerID [20]byte, port uint16) (*TrackerResponse, error) {
+	u, client, err := LookupTrackerClient(trackerURL)
+	if err != nil {
+		return nil, err
+	}
+	return client.Announce(u, t, AnnounceRequest{PeerID: peerID, Port: port})
+}
+
+// ScrapeTracker asks the given tracker for the swarm statistics of the torrent.
+func (t *Torrent) ScrapeTracker(trackerURL string) (*ScrapeResponse, error) {
+	u, client, err := LookupTrackerClient(trackerURL)
+	if err != nil {
+		return nil, err
+	}
+	return client.Scrape(u, t)
+}
+
+// httpTracker announces torrents to HTTP and HTTPS trackers.
+type httpTracker struct {
+	http *tracker.HTTP
+}
+
+// defaultHTTPTracker is registered for the http and https schemes.
+var defaultHTTPTracker = &httpTracker{http: tracker.NewHTTP(newTrackerHTTPClient(newCachingDialer(nil)))}
+
+// NewHTTPTracker returns a client for HTTP and HTTPS trackers that connects through dialer.
+// A nil dialer uses the default dialing settings. Host names are resolved
+// locally only for *net.Dialer; any other Dialer receives them unresolved so
+// that proxies such as Tor can resolve them remotely.
+func NewHTTPTracker(dialer Dialer) TrackerClient {
+	return NewHTTPTrackerForNetwork(dialer, "tcp")
+}
+
+// NewHTTPTrackerForNetwork is like NewHTTPTracker but only connects over
+// network, which is "tcp4" or "tcp6" to announce over a single address family.
+func NewHTTPTrackerForNetwork(dialer Dialer, network string) TrackerClient {
+	switch d := dialer.(type) {
+	case nil:
+		dialer = newCachingDialer(nil)
+	case *net.Dialer:
+		dialer = newCachingDialer(d)
+	}
+	if network != "tcp" {
+		dialer = networkDialer{dialer: dialer, network: network}
+	}
+	return &httpTracker{http: tracker.NewHTTP(newTrackerHTTPClient(dialer))}
+}
+
+// Announce announces the torrent to the tracker.
+func (h *httpTracker) Announce(trackerURL *url.URL, t *Torrent, req AnnounceRequest) (*TrackerResponse, error) {
+	return h.http.Announce(trackerURL, tracker.Request{
+		InfoHash:    t.InfoHash,
+		PeerID:      req.PeerID,
+		Port:        req.Port,
+		Left:        t.Info.TotalLength(),
+		Event:       req.Event,
+		ExtraParams: req.ExtraParams,
+	})
+}
+
+// Scrape asks the tracker for the swarm statistics of the torrent.
+func (h *httpTracker) Scrape(trackerURL *url.URL, t *Torrent) (*ScrapeResponse, error) {
+	return h.http.Scrape(trackerURL, t.InfoHash)
+}
@@ -0,0 +1,108 @@
+package torrent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ErrTrackerDenied is returned for trackers whose operator asked, through
+// DNS, not to be contacted (BEP 34).
+var ErrTrackerDenied = errors.New("tracker denied by DNS record")
+
+// TrackerPreference is the protocol and port preference a tracker operator
+// publishes in a "BITTORRENT" TXT record on the tracker's host name (BEP 34).
+type TrackerPreference struct {
+	// Deny is set when the tracker must not be contacted at all.
+	Deny bool
+	// Endpoints lists the protocols and ports to use, most preferred first.
+	Endpoints []TrackerEndpoint
+}
+
+// TrackerEndpoint is a protocol and port a tracker can be reached on.
+type TrackerEndpoint struct {
+	// UDP selects the UDP tracker protocol; otherwise the tracker speaks HTTP over TCP.
+	UDP  bool
+	Port uint16
+}
+
+// ParseTrackerPreference parses the text of a TXT record. ok is false if the
+// record isn't a BEP 34 record. A record without endpoints, like
+// "BITTORRENT DENY ALL", denies the tracker.
+func ParseTrackerPreference(txt string) (pref TrackerPreference, ok bool) {
+	fields := strings.Fields(txt)
+	if len(fields) == 0 || fields[0] != "BITTORRENT" {
+		return TrackerPreference{}, false
+	}
+	for _, field := range fields[1:] {
+		proto, port, found := strings.Cut(field, ":")
+		if !found {
+			continue
+		}
+		n, err := strconv.ParseUint(port, 10, 16)
+		if err != nil || n == 0 {
+			continue
+		}
+		switch proto {
+		case "UDP":
+			pref.Endpoints = append(pref.Endpoints, TrackerEndpoint{UDP: true, Port: uint16(n)})
+		case "TCP":
+			pref.Endpoints = append(pref.Endpoints, TrackerEndpoint{Port: uint16(n)})
+		}
+	}
+	pref.Deny = len(pref.Endpoints) == 0
+	return pref, true
+}
+
+// LookupTrackerPreference looks up the BEP 34 record of a tracker host. It
+// returns nil if the host publishes none, including when the lookup fails,
+// since most tracker hosts have no TXT records at all.
+func LookupTrackerPreference(ctx context.Context, resolver *net.Resolver, host string) *TrackerPreference {
+	if _, err := netip.ParseAddr(host); err == nil {
+		return nil
+	}
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	records, err := resolver.LookupTXT(ctx, host)
+	if err != nil {
+		return nil
+	}
+	for _, record := range records {
+		if pref, ok := ParseTrackerPreference(record); ok {
+			return &pref
+		}
+	}
+	return nil
+}
+
+// Apply returns the announce URLs to try for trackerURL, in order of
+// preference. TCP endpoints keep the URL's scheme, so an https tracker stays
+// https, and UDP endpoints become udp:// URLs. A nil preference leaves
+// trackerURL as it is.
+func (p *TrackerPreference) Apply(trackerURL *url.URL) ([]*url.URL, error) {
+	if p == nil {
+		return []*url.URL{trackerURL}, nil
+	}
+	if p.Deny {
+		return nil, fmt.Errorf("%w: %s", ErrTrackerDenied, trackerURL.Hostname())
+	}
+
+	var urls []*url.URL
+	for _, endpoint := range p.Endpoints {
+		u := *trackerURL
+		u.Host = net.JoinHostPort(trackerURL.Hostname(), strconv.Itoa(int(endpoint.Port)))
+		if endpoint.UDP {
+			u.Scheme = "udp"
+		} else if u.Scheme == "udp" {
+			u.Scheme = "http"
+		}
+		urls = append(urls, &u)
+	}
+	return urls, nil
+}
@@ -0,0 +1,69 @@
+package torrent
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	// minPieceLength is the smallest piece length accepted, one block.
+	minPieceLength = 16 * 1024
+	// maxPieceLength is the largest piece length accepted.
+	maxPieceLength = 64 * 1024 * 1024
+)
+
+// TotalLength returns the total size of the content described by the info dictionary.
+func (info Info) TotalLength() int64 {
+	if len(info.Files) == 0 {
+		return info.Length
+	}
+	var total int64
+	for _, f := range info.Files {
+		total += f.Length
+	}
+	return total
+}
+
+// Validate checks that the parsed info dictionary is consistent before the torrent is used.
+func (info Info) Validate() error {
+	if info.Name == "" {
+		return fmt.Errorf("torrent has an empty name")
+	}
+
+	if info.PieceLength < minPieceLength || info.PieceLength > maxPieceLength {
+		return fmt.Errorf("piece length %d is outside the range %d to %d", info.PieceLength, minPieceLength, maxPieceLength)
+	}
+	if info.PieceLength&(info.PieceLength-1) != 0 {
+		return fmt.Errorf("piece length %d is not a power of two", info.PieceLength)
+	}
+
+	if len(info.Files) == 0 && info.Length <= 0 {
+		return fmt.Errorf("torrent has no files")
+	}
+	var sum int64
+	for i, f := range info.Files {
+		if f.Length < 0 {
+			return fmt.Errorf("file %d has a negative length", i)
+		}
+		if f.Length > math.MaxInt64-sum {
+			return fmt.Errorf("total length of files overflows")
+		}
+		sum += f.Length
+		if len(f.Path) == 0 {
+			return fmt.Errorf("file %d has an empty path", i)
+		}
+	}
+
+	total := info.TotalLength()
+	if total <= 0 {
+		return fmt.Errorf("torrent has a total length of zero")
+	}
+	expected := total / info.PieceLength
+	if total%info.PieceLength != 0 {
+		expected++
+	}
+	if int64(len(info.Pieces)) != expected {
+		return fmt.Errorf("torrent has %d piece hashes, expected %d for %d bytes", len(info.Pieces), expected, total)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package torrent
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// VerifyDir checks which pieces of the torrent are already present in dir,
+// with the content laid out as a download leaves it: dir/<name> for a
+// single-file torrent and dir/<name>/<path> for a multi-file one. Missing or
+// short files fail the pieces they cover rather than returning an error.
+// The result is indexed by piece and can be passed to FileCompletion.
+func (info Info) VerifyDir(dir string) ([]bool, error) {
+	extents := info.FileExtents()
+	files := make([]*os.File, len(extents))
+	defer func() {
+		for _, f := range files {
+			if f != nil {
+				f.Close()
+			}
+		}
+	}()
+	for i, e := range extents {
+		path, err := info.localPath(dir, e.Path)
+		if err != nil {
+			return nil, err
+		}
+		f, err := os.Open(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s: %w", path, err)
+		}
+		files[i] = f
+	}
+
+	verified := make([]bool, len(info.Pieces))
+	buf := make([]byte, info.PieceLength)
+	next := 0
+	for piece := range info.Pieces {
+		start := int64(piece) * info.PieceLength
+		size := info.PieceSize(piece)
+		// Files are in content order, so skip the ones ending before this piece.
+		for next < len(extents) && extents[next].Offset+extents[next].Length <= start {
+			next++
+		}
+
+		complete := true
+		for i := next; complete && i < len(extents) && extents[i].Offset < start+size; i++ {
+			e := extents[i]
+			from := max(start, e.Offset)
+			to := min(start+size, e.Offset+e.Length)
+			if to <= from {
+				continue
+			}
+			if files[i] == nil {
+				complete = false
+				break
+			}
+			_, err := files[i].ReadAt(buf[from-start:to-start], from-e.Offset)
+			if err == io.EOF {
+				complete = false
+			} else if err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", files[i].Name(), err)
+			}
+		}
+		if complete {
+			hash := sha1.Sum(buf[:size])
+			verified[piece] = bytes.Equal(hash[:], info.Pieces[piece][:])
+		}
+	}
+	return verified, nil
+}
+
+// localPath returns where file path of the torrent lives under dir, refusing
+// paths that would escape it.
+func (info Info) localPath(dir string, path []string) (string, error) {
+	rel := filepath.Join(path...)
+	if len(info.Files) > 0 {
+		rel = filepath.Join(info.Name, rel)
+	}
+	if !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("file path %q escapes the download directory", rel)
+	}
+	return filepath.Join(dir, rel), nil
+}
@@ -0,0 +1,90 @@
+package torrent
+
+import (
+	"crypto/sha1"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// multiFileInfo describes content split into files of the given sizes, hashed
+// into 4 byte pieces so that pieces span file boundaries.
+func multiFileInfo(content []byte, sizes ...int64) Info {
+	info := Info{Name: "multi", PieceLength: 4}
+	for i, size := range sizes {
+		info.Files = append(info.Files, File{Length: size, Path: []string{"dir", string(rune('a' + i))}})
+	}
+	for start := 0; start < len(content); start += 4 {
+		info.Pieces = append(info.Pieces, sha1.Sum(content[start:min(start+4, len(content))]))
+	}
+	return info
+}
+
+// writeContent lays content out under dir the way a download of info would.
+func writeContent(t *testing.T, dir string, info Info, content []byte) {
+	for _, e := range info.FileExtents() {
+		path := filepath.Join(append([]string{dir, info.Name}, e.Path...)...)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, content[e.Offset:e.Offset+e.Length], 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestVerifyDir(t *testing.T) {
+	content := []byte("0123456789ab")
+	// Pieces: 0123 | 4567 | 89ab, files: 012345 | 6789ab.
+	info := multiFileInfo(content, 6, 6)
+	dir := t.TempDir()
+	writeContent(t, dir, info, content)
+	fileA := filepath.Join(dir, "multi", "dir", "a")
+	fileB := filepath.Join(dir, "multi", "dir", "b")
+
+	check := func(name string, want ...bool) {
+		t.Helper()
+		got, err := info.VerifyDir(dir)
+		if err != nil {
+			t.Fatalf("%s: VerifyDir: %v", name, err)
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("%s: VerifyDir = %v, want %v", name, got, want)
+		}
+	}
+	check("complete", true, true, true)
+
+	os.WriteFile(fileB, []byte("6x89ab"), 0o644)
+	check("corrupt byte in the spanning piece", true, false, true)
+
+	os.WriteFile(fileB, []byte("6789a"), 0o644)
+	check("short last file", true, true, false)
+
+	os.Remove(fileA)
+	check("missing first file", false, false, false)
+}
+
+func TestVerifyDirSingleFile(t *testing.T) {
+	content := []byte("0123456")
+	info := Info{Name: "single", PieceLength: 4, Length: int64(len(content)),
+		Pieces: [][20]byte{sha1.Sum(content[:4]), sha1.Sum(content[4:])}}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "single"), content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := info.VerifyDir(dir)
+	if err != nil || !slices.Equal(got, []bool{true, true}) {
+		t.Errorf("VerifyDir = %v, %v, want [true true]", got, err)
+	}
+}
+
+func TestVerifyDirPathTraversal(t *testing.T) {
+	content := []byte("01234567")
+	info := multiFileInfo(content, 4, 4)
+	info.Files[1].Path = []string{"..", "..", "escape"}
+	dir := t.TempDir()
+	if _, err := info.VerifyDir(filepath.Join(dir, "download")); err == nil {
+		t.Error("VerifyDir accepted a file path escaping the download directory")
+	}
+}